@@ -0,0 +1,125 @@
+package superstream
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+type (
+	keyAffinity struct {
+		// hash is a func(K) uint64, nil to use keyHash
+		hash any
+	}
+
+	// affinityDispatcher routes every item to the worker its key hashes to,
+	// each worker has a queue of its own and maps its items one after another
+	affinityDispatcher[K comparable, I any] struct {
+		queues    []chan Item[K, I]
+		chunkSize int
+	}
+)
+
+// WithKeyAffinity makes all the items with the same key go to the same mapper,
+// in the order they come from the source, while different keys are still
+// mapped concurrently. Keys are assigned to mappers by hash, which has to accept
+// the key type of the source, nil hashes keys by their default format.
+// Every mapper has a queue of its own, bounded by WithQueueSize.
+func WithKeyAffinity[K any](hash func(K) uint64) reducerOption {
+	return func(fc *flowControl) {
+		if hash == nil {
+			fc.affinity = &keyAffinity{}
+		} else {
+			fc.affinity = &keyAffinity{hash: hash}
+		}
+	}
+}
+
+func affinityHash[K comparable](fc *flowControl) (func(K) uint64, error) {
+	if fc.affinity.hash == nil {
+		return keyHash[K], nil
+	}
+
+	hash, ok := fc.affinity.hash.(func(K) uint64)
+	if !ok {
+		return nil, fmt.Errorf(
+			"%w: WithKeyAffinity expects a %T, got a %T",
+			ErrInvalidOption, hash, fc.affinity.hash,
+		)
+	}
+
+	return hash, nil
+}
+
+func keyHash[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case int:
+		return mix(uint64(k))
+	case int64:
+		return mix(uint64(k))
+	case uint64:
+		return mix(k)
+	}
+
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%v", key)
+	return h.Sum64()
+}
+
+// mix spreads sequential integers over all the workers
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+func newAffinityDispatcher[K comparable, I any](
+	ctx context.Context,
+	fc *flowControl,
+	tasks *sync.WaitGroup,
+	src dispatcher[K, I],
+	hash func(K) uint64,
+) *affinityDispatcher[K, I] {
+	d := &affinityDispatcher[K, I]{
+		queues:    make([]chan Item[K, I], fc.concurrency),
+		chunkSize: fc.chunkSize,
+	}
+
+	for w := range d.queues {
+		d.queues[w] = make(chan Item[K, I], fc.queueSize)
+	}
+
+	tasks.Add(1)
+	go func() {
+		defer tasks.Done()
+		defer func() {
+			for _, q := range d.queues {
+				close(q)
+			}
+		}()
+
+		for {
+			chunk, ok := src.next(ctx, 0)
+			if !ok {
+				return
+			}
+
+			for _, item := range chunk {
+				q := d.queues[hash(item.Key)%uint64(len(d.queues))]
+				select {
+				case q <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return d
+}
+
+func (d *affinityDispatcher[K, I]) next(ctx context.Context, worker int) ([]Item[K, I], bool) {
+	return gather(ctx, d.queues[worker], d.chunkSize)
+}
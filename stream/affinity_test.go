@@ -0,0 +1,188 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type update = stream.Item[string, int]
+
+// accountUpdates yields n updates for each of the accounts, the value
+// of an update being its sequence number within the account
+func accountUpdates(accounts, n int) stream.Iterable[string, int] {
+	return func(ctx context.Context) <-chan update {
+		resultCh := make(chan update)
+		go func() {
+			defer close(resultCh)
+			for seq := 0; seq < n; seq++ {
+				for a := 0; a < accounts; a++ {
+					select {
+					case resultCh <- update{Key: fmt.Sprintf("account-%d", a), Value: seq}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		return resultCh
+	}
+}
+
+func Test_KeyAffinity(t *testing.T) {
+	const accounts, n = 10, 200
+
+	t.Run("updates of an account are mapped one at a time and in order", func(t *testing.T) {
+		var mux sync.Mutex
+		inFlight := make(map[string]bool)
+		lastMapped := make(map[string]int)
+		var concurrentKeys, maxConcurrentKeys int
+
+		mapper := func(_ context.Context, item update) (update, error) {
+			mux.Lock()
+			assert.False(t, inFlight[item.Key], "%s is already being mapped", item.Key)
+			inFlight[item.Key] = true
+			if last, ok := lastMapped[item.Key]; ok {
+				assert.Equal(t, last+1, item.Value, "%s mapped out of order", item.Key)
+			}
+			lastMapped[item.Key] = item.Value
+			concurrentKeys++
+			if concurrentKeys > maxConcurrentKeys {
+				maxConcurrentKeys = concurrentKeys
+			}
+			mux.Unlock()
+
+			time.Sleep(10 * time.Microsecond)
+
+			mux.Lock()
+			inFlight[item.Key] = false
+			concurrentKeys--
+			mux.Unlock()
+			return item, nil
+		}
+
+		reducer := func(_ context.Context, acc map[string][]int, item update) (map[string][]int, error) {
+			acc[item.Key] = append(acc[item.Key], item.Value)
+			return acc, nil
+		}
+
+		result, err := stream.MapReduce(
+			context.TODO(),
+			accountUpdates(accounts, n),
+			mapper,
+			reducer,
+			map[string][]int{},
+			stream.WithConcurrency(4),
+			stream.WithKeyAffinity[string](nil),
+			stream.WithQueueSize(8),
+		)
+		require.NoError(t, err)
+		require.Len(t, result, accounts)
+
+		for account, seqs := range result {
+			require.Len(t, seqs, n)
+			for i, seq := range seqs {
+				require.Equal(t, i, seq, "%s reduced out of order", account)
+			}
+		}
+
+		assert.True(t, maxConcurrentKeys > 1, "expected different accounts to be mapped concurrently")
+	})
+
+	t.Run("custom hash decides the worker", func(t *testing.T) {
+		var mux sync.Mutex
+		inFlight := 0
+
+		// every key goes to the same worker, so nothing runs concurrently
+		sameWorker := func(string) uint64 { return 7 }
+		mapper := func(_ context.Context, item update) (update, error) {
+			mux.Lock()
+			inFlight++
+			assert.Equal(t, 1, inFlight)
+			mux.Unlock()
+
+			time.Sleep(10 * time.Microsecond)
+
+			mux.Lock()
+			inFlight--
+			mux.Unlock()
+			return item, nil
+		}
+
+		count, err := stream.MapReduce(
+			context.TODO(),
+			accountUpdates(accounts, 20),
+			mapper,
+			func(_ context.Context, acc int, item update) (int, error) { return acc + 1, nil },
+			0,
+			stream.WithConcurrency(4),
+			stream.WithKeyAffinity(sameWorker),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, accounts*20, count)
+	})
+
+	t.Run("chunked and ranged sources keep their order", func(t *testing.T) {
+		in := make([]int, 1000)
+		for _, source := range []stream.Iterable[int, int]{stream.Slice(in), stream.ParallelSlice(in)} {
+			keys, err := stream.MapReduce(
+				context.TODO(),
+				source,
+				func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+					return stream.Item[int, int]{Key: item.Key % 10, Value: item.Key}, nil
+				},
+				func(_ context.Context, acc map[int][]int, item stream.Item[int, int]) (map[int][]int, error) {
+					acc[item.Key] = append(acc[item.Key], item.Value)
+					return acc, nil
+				},
+				map[int][]int{},
+				stream.WithConcurrency(3),
+				stream.WithKeyAffinity[int](func(k int) uint64 { return uint64(k % 10) }),
+			)
+			require.NoError(t, err)
+
+			for _, values := range keys {
+				for i := 1; i < len(values); i++ {
+					require.True(t, values[i-1] < values[i])
+				}
+			}
+		}
+	})
+
+	t.Run("non-positive concurrency still gets a queue", func(t *testing.T) {
+		for _, c := range []int{0, -1} {
+			count, err := stream.MapReduce(
+				context.TODO(),
+				accountUpdates(accounts, 1),
+				func(_ context.Context, item update) (update, error) { return item, nil },
+				func(_ context.Context, acc int, item update) (int, error) { return acc + 1, nil },
+				0,
+				stream.WithConcurrency(c),
+				stream.WithKeyAffinity[string](nil),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, accounts, count)
+		}
+	})
+
+	t.Run("hash of the wrong key type", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			accountUpdates(accounts, 1),
+			func(_ context.Context, item update) (update, error) { return item, nil },
+			func(_ context.Context, acc int, item update) (int, error) { return acc + 1, nil },
+			0,
+			stream.WithKeyAffinity(func(int) uint64 { return 0 }),
+		)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+		assert.Equal(t, "invalid option: WithKeyAffinity expects a func(string) uint64, got a func(int) uint64", err.Error())
+	})
+}
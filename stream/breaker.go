@@ -0,0 +1,294 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow  = 20
+	defaultBreakerOpenFor = time.Second
+)
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var (
+	ErrBreakerOpen = errors.New("circuit breaker is open")
+)
+
+type (
+	BreakerState uint8
+
+	// BreakerConfig describes when a circuit breaker opens and how it recovers.
+	// At least one of ConsecutiveFailures and ErrorRate has to be set.
+	BreakerConfig struct {
+		// ConsecutiveFailures opens the breaker after that many failed calls in a row
+		ConsecutiveFailures int
+		// ErrorRate opens the breaker once the share of failed calls among
+		// the last Window calls reaches it, a value between 0 and 1
+		ErrorRate float64
+		// Window is the number of most recent calls ErrorRate is computed over, 20 by default
+		Window int
+		// OpenFor is how long the breaker stays open before it lets probe calls through
+		OpenFor time.Duration
+		// Probes is the number of successful probe calls in a row
+		// it takes to close a half-open breaker, 1 by default
+		Probes int
+		// Wait makes items wait for the breaker to let them through
+		// instead of failing right away with ErrBreakerOpen
+		Wait bool
+		// OnStateChange is called synchronously on every state change
+		OnStateChange func(from, to BreakerState)
+	}
+
+	circuitBreaker struct {
+		cfg BreakerConfig
+
+		mux         sync.Mutex
+		state       BreakerState
+		openedAt    time.Time
+		consecutive int
+		// outcomes is a ring of the last cfg.Window calls, true meaning failed
+		outcomes []bool
+		next     int
+		filled   int
+		failures int
+		// probing and probed count probe calls in flight and probe calls that succeeded
+		probing int
+		probed  int
+		// changedCh is closed on every state change to wake up waiting calls
+		changedCh chan struct{}
+	}
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// WithCircuitBreaker puts a circuit breaker in front of the mapper, so
+// that a failing dependency is given a rest instead of being called for
+// every remaining item. Calls rejected by an open breaker fail with
+// ErrBreakerOpen and count towards the error threshold like any other error.
+// A config that could never open the breaker makes MapReduce return ErrInvalidOption.
+func WithCircuitBreaker(cfg BreakerConfig) reducerOption {
+	return func(fc *flowControl) {
+		if cfg.Window <= 0 {
+			cfg.Window = defaultBreakerWindow
+		}
+		if cfg.OpenFor <= 0 {
+			cfg.OpenFor = defaultBreakerOpenFor
+		}
+		if cfg.Probes <= 0 {
+			cfg.Probes = 1
+		}
+		fc.breaker = &cfg
+	}
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:       cfg,
+		outcomes:  make([]bool, cfg.Window),
+		changedCh: make(chan struct{}),
+	}
+}
+
+// breakerMapper runs every call to the mapper past a fresh circuit breaker
+func breakerMapper[K comparable, I, O any](fc *flowControl, m mapper[K, I, O]) (mapper[K, I, O], error) {
+	if fc.breaker == nil {
+		return m, nil
+	}
+
+	cfg := *fc.breaker
+	if cfg.ConsecutiveFailures < 0 || cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		return nil, fmt.Errorf(
+			"%w: WithCircuitBreaker needs a non-negative ConsecutiveFailures and an ErrorRate between 0 and 1, got %d and %v",
+			ErrInvalidOption, cfg.ConsecutiveFailures, cfg.ErrorRate,
+		)
+	}
+	// a breaker with neither would never open
+	if cfg.ConsecutiveFailures == 0 && cfg.ErrorRate == 0 {
+		return nil, fmt.Errorf("%w: WithCircuitBreaker needs ConsecutiveFailures or ErrorRate", ErrInvalidOption)
+	}
+
+	cb := newCircuitBreaker(cfg)
+	return func(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+		probe, err := cb.acquire(ctx)
+		if err != nil {
+			return Zero[Item[K, O]](), err
+		}
+
+		result, err := safeMap(ctx, m, item)
+		if ctx.Err() == nil {
+			cb.report(probe, err != nil && !errors.Is(err, ErrSkip))
+		} else if probe {
+			cb.abandon()
+		}
+
+		return result, err
+	}, nil
+}
+
+// acquire lets a call through or tells why it cannot go
+func (cb *circuitBreaker) acquire(ctx context.Context) (probe bool, err error) {
+	for {
+		cb.mux.Lock()
+		var wait time.Duration
+		switch cb.state {
+		case BreakerClosed:
+			cb.mux.Unlock()
+			return false, nil
+		case BreakerOpen:
+			if left := cb.cfg.OpenFor - time.Since(cb.openedAt); left > 0 {
+				wait = left
+				break
+			}
+			cb.transition(BreakerHalfOpen)
+			fallthrough
+		case BreakerHalfOpen:
+			if cb.probing+cb.probed < cb.cfg.Probes {
+				cb.probing++
+				cb.mux.Unlock()
+				return true, nil
+			}
+		}
+
+		changedCh := cb.changedCh
+		cb.mux.Unlock()
+
+		if !cb.cfg.Wait {
+			return false, ErrBreakerOpen
+		}
+
+		if err := waitForChange(ctx, changedCh, wait); err != nil {
+			return false, err
+		}
+	}
+}
+
+func waitForChange(ctx context.Context, changedCh <-chan struct{}, timeout time.Duration) error {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-changedCh:
+	case <-timeoutCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+func (cb *circuitBreaker) report(probe bool, failed bool) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+
+	if probe {
+		cb.probing--
+		if cb.state != BreakerHalfOpen {
+			return
+		}
+
+		if failed {
+			cb.open()
+			return
+		}
+
+		cb.probed++
+		if cb.probed >= cb.cfg.Probes {
+			cb.transition(BreakerClosed)
+		}
+		return
+	}
+
+	if cb.state != BreakerClosed {
+		return
+	}
+
+	cb.record(failed)
+	if cb.tripped() {
+		cb.open()
+	}
+}
+
+// abandon gives back a probe slot of a call that was cut short by cancellation
+func (cb *circuitBreaker) abandon() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.probing--
+}
+
+func (cb *circuitBreaker) record(failed bool) {
+	if failed {
+		cb.consecutive++
+	} else {
+		cb.consecutive = 0
+	}
+
+	if cb.filled == len(cb.outcomes) && cb.outcomes[cb.next] {
+		cb.failures--
+	}
+
+	cb.outcomes[cb.next] = failed
+	if failed {
+		cb.failures++
+	}
+
+	cb.next = (cb.next + 1) % len(cb.outcomes)
+	if cb.filled < len(cb.outcomes) {
+		cb.filled++
+	}
+}
+
+func (cb *circuitBreaker) tripped() bool {
+	if cb.cfg.ConsecutiveFailures > 0 && cb.consecutive >= cb.cfg.ConsecutiveFailures {
+		return true
+	}
+
+	if cb.cfg.ErrorRate > 0 && cb.filled == len(cb.outcomes) {
+		return float64(cb.failures)/float64(cb.filled) >= cb.cfg.ErrorRate
+	}
+
+	return false
+}
+
+func (cb *circuitBreaker) open() {
+	cb.openedAt = time.Now()
+	cb.transition(BreakerOpen)
+}
+
+// transition must be called with the lock held
+func (cb *circuitBreaker) transition(to BreakerState) {
+	from := cb.state
+	cb.state = to
+	cb.consecutive, cb.failures, cb.next, cb.filled = 0, 0, 0, 0
+	cb.probed = 0
+
+	close(cb.changedCh)
+	cb.changedCh = make(chan struct{})
+
+	if cb.cfg.OnStateChange != nil {
+		cb.cfg.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,215 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type transitions struct {
+	mux sync.Mutex
+	log []string
+}
+
+func (tr *transitions) observe(from, to stream.BreakerState) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+	tr.log = append(tr.log, fmt.Sprintf("%s->%s", from, to))
+}
+
+func (tr *transitions) all() []string {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+	return append([]string(nil), tr.log...)
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	const n = 100
+
+	type intItem = stream.Item[int, int]
+
+	in := make([]int, n)
+	for i := range in {
+		in[i] = i
+	}
+
+	count := func(_ context.Context, acc int, item intItem) (int, error) {
+		return acc + 1, nil
+	}
+
+	t.Run("consecutive failures open the breaker and items fail fast", func(t *testing.T) {
+		var calls int32
+		var tr transitions
+
+		failing := func(_ context.Context, item intItem) (intItem, error) {
+			atomic.AddInt32(&calls, 1)
+			return item, errors.New("service is down")
+		}
+
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			failing,
+			count,
+			0,
+			stream.ErrorThreshold(10),
+			stream.WithCircuitBreaker(stream.BreakerConfig{
+				ConsecutiveFailures: 3,
+				OpenFor:             time.Minute,
+				OnStateChange:       tr.observe,
+			}),
+		)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, stream.ErrBreakerOpen))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		assert.Equal(t, []string{"closed->open"}, tr.all())
+	})
+
+	t.Run("error rate opens the breaker", func(t *testing.T) {
+		var calls int32
+		var tr transitions
+
+		flaky := func(_ context.Context, item intItem) (intItem, error) {
+			atomic.AddInt32(&calls, 1)
+			if item.Key%2 == 0 {
+				return item, errors.New("service is flaky")
+			}
+			return item, nil
+		}
+
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			flaky,
+			count,
+			0,
+			stream.ErrorThreshold(n),
+			stream.WithCircuitBreaker(stream.BreakerConfig{
+				ErrorRate:     0.5,
+				Window:        10,
+				OpenFor:       time.Minute,
+				OnStateChange: tr.observe,
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, int32(10), atomic.LoadInt32(&calls))
+		assert.Equal(t, []string{"closed->open"}, tr.all())
+	})
+
+	t.Run("waiting items go through once the breaker closes", func(t *testing.T) {
+		var calls int32
+		var tr transitions
+
+		recovering := func(_ context.Context, item intItem) (intItem, error) {
+			if atomic.AddInt32(&calls, 1) <= 5 {
+				return item, errors.New("service is down")
+			}
+			return item, nil
+		}
+
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			recovering,
+			count,
+			0,
+			stream.WithConcurrency(4),
+			stream.ErrorThreshold(n),
+			stream.WithCircuitBreaker(stream.BreakerConfig{
+				ConsecutiveFailures: 5,
+				OpenFor:             10 * time.Millisecond,
+				Probes:              2,
+				Wait:                true,
+				OnStateChange:       tr.observe,
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, n-5, result)
+		assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, tr.all())
+	})
+
+	t.Run("failed probe opens the breaker again", func(t *testing.T) {
+		var calls int32
+		var tr transitions
+
+		recovering := func(_ context.Context, item intItem) (intItem, error) {
+			if atomic.AddInt32(&calls, 1) <= 3 {
+				return item, errors.New("service is down")
+			}
+			return item, nil
+		}
+
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			recovering,
+			count,
+			0,
+			stream.ErrorThreshold(n),
+			stream.WithCircuitBreaker(stream.BreakerConfig{
+				ConsecutiveFailures: 2,
+				OpenFor:             5 * time.Millisecond,
+				Wait:                true,
+				OnStateChange:       tr.observe,
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, n-3, result)
+		assert.Equal(t, []string{
+			"closed->open",
+			"open->half-open",
+			"half-open->open",
+			"open->half-open",
+			"half-open->closed",
+		}, tr.all())
+	})
+
+	t.Run("waiting items give up when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		failing := func(_ context.Context, item intItem) (intItem, error) {
+			return item, errors.New("service is down")
+		}
+
+		assertNoLeaks(t, func() {
+			_, err := stream.MapReduce(
+				ctx,
+				stream.Slice(in),
+				failing,
+				count,
+				0,
+				stream.WithConcurrency(4),
+				stream.ErrorThreshold(n),
+				stream.WithCircuitBreaker(stream.BreakerConfig{
+					ConsecutiveFailures: 1,
+					OpenFor:             time.Minute,
+					Wait:                true,
+				}),
+			)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		})
+	})
+	t.Run("a breaker that could never open is an invalid option", func(t *testing.T) {
+		identity := func(_ context.Context, item intItem) (intItem, error) { return item, nil }
+
+		for _, cfg := range []stream.BreakerConfig{
+			{},
+			{ErrorRate: 1.5},
+			{ConsecutiveFailures: -1},
+			{ErrorRate: -0.5},
+		} {
+			_, err := stream.MapReduce(context.TODO(), stream.Slice(in), identity, count, 0, stream.WithCircuitBreaker(cfg))
+			assert.True(t, errors.Is(err, stream.ErrInvalidOption), "config %+v", cfg)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package superstream
+
+import (
+	"context"
+	"time"
+)
+
+const defaultMaxPartialMatches = 64
+
+type (
+	// Pattern is a sequence of steps, every step matches items with a predicate.
+	// Steps follow each other with relaxed contiguity: items that match no step
+	// in between are ignored.
+	Pattern[K, V any] struct {
+		steps  []patternStep[K, V]
+		within time.Duration
+	}
+
+	patternStep[K, V any] struct {
+		name     string
+		match    func(Item[K, V]) bool
+		times    int
+		optional bool
+	}
+
+	// PatternOptions configures MatchPattern
+	PatternOptions[K, V any] struct {
+		// Timestamp tells when an item happened, nil to use the time it arrived at on Clock
+		Timestamp func(Item[K, V]) time.Time
+		// Clock is used when there is no Timestamp, nil for SystemClock
+		Clock Clock
+		// MaxPartialMatches bounds the partial matches kept for every key, the oldest
+		// ones are dropped to make room for new ones, 64 by default
+		MaxPartialMatches int
+	}
+
+	// Match holds the items that matched a pattern, in order
+	Match[K, V any] struct {
+		Events []Item[K, V]
+		// Steps has the items that matched every step by the name of the step
+		Steps map[string][]Item[K, V]
+	}
+
+	// partialMatch is a run of the pattern NFA, waiting for step next
+	partialMatch[K, V any] struct {
+		next    int
+		events  []Item[K, V]
+		steps   []int
+		started time.Time
+	}
+)
+
+// Begin starts a pattern with a step that matches items that satisfy match
+func Begin[K, V any](name string, match func(Item[K, V]) bool) *Pattern[K, V] {
+	return &Pattern[K, V]{steps: []patternStep[K, V]{{name: name, match: match, times: 1}}}
+}
+
+// FollowedBy adds a step that has to match after the previous ones
+func (p *Pattern[K, V]) FollowedBy(name string, match func(Item[K, V]) bool) *Pattern[K, V] {
+	p.steps = append(p.steps, patternStep[K, V]{name: name, match: match, times: 1})
+	return p
+}
+
+// Times makes the last step match n items instead of one
+func (p *Pattern[K, V]) Times(n int) *Pattern[K, V] {
+	if n > 0 {
+		p.steps[len(p.steps)-1].times = n
+	}
+	return p
+}
+
+// Optional lets the last step be skipped. An optional step at the end
+// of the pattern is never waited for, the match is complete without it.
+func (p *Pattern[K, V]) Optional() *Pattern[K, V] {
+	p.steps[len(p.steps)-1].optional = true
+	return p
+}
+
+// Within requires the whole pattern to match within d of its first item
+func (p *Pattern[K, V]) Within(d time.Duration) *Pattern[K, V] {
+	p.within = d
+	return p
+}
+
+// MatchPattern looks for the pattern in the items of every key and emits a
+// Match for every occurrence, keyed by the key it was found for. Every item
+// may start a new partial match and every partial match advances on the first
+// item that matches its next step. Once a match is found, the partial matches
+// of its key are dropped, so matches never overlap.
+func MatchPattern[K comparable, V any](iterable Iterable[K, V], p *Pattern[K, V], opts PatternOptions[K, V]) Iterable[K, Match[K, V]] {
+	clock := opts.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	limit := opts.MaxPartialMatches
+	if limit <= 0 {
+		limit = defaultMaxPartialMatches
+	}
+
+	// the NFA has a state for every item a step matches, times included
+	var states []int
+	for i, step := range p.steps {
+		for n := 0; n < step.times; n++ {
+			states = append(states, i)
+		}
+	}
+
+	// a state is optional when its step is and it is the first state of it,
+	// the other states of a step that has matched once are not
+	optional := func(state int) bool {
+		return p.steps[states[state]].optional && (state == 0 || states[state-1] != states[state])
+	}
+
+	// complete tells whether the states from next on may all be skipped
+	complete := func(next int) bool {
+		for state := next; state < len(states); {
+			if !optional(state) {
+				return false
+			}
+
+			step := states[state]
+			for state < len(states) && states[state] == step {
+				state++
+			}
+		}
+		return true
+	}
+
+	// advance returns the partial match moved on by item, or nil
+	advance := func(pm *partialMatch[K, V], item Item[K, V]) *partialMatch[K, V] {
+		for state := pm.next; state < len(states); {
+			if p.steps[states[state]].match(item) {
+				return &partialMatch[K, V]{
+					next:    state + 1,
+					events:  append(pm.events[:len(pm.events):len(pm.events)], item),
+					steps:   append(pm.steps[:len(pm.steps):len(pm.steps)], states[state]),
+					started: pm.started,
+				}
+			}
+
+			if !optional(state) {
+				return nil
+			}
+
+			// skip the whole optional step
+			step := states[state]
+			for state < len(states) && states[state] == step {
+				state++
+			}
+		}
+		return nil
+	}
+
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, Match[K, V]]) bool) {
+		partials := make(map[K][]*partialMatch[K, V])
+		expired := func(pm *partialMatch[K, V], now time.Time) bool {
+			return p.within > 0 && now.Sub(pm.started) > p.within
+		}
+
+		seen := 0
+		for item := range inCh {
+			now := clock.Now()
+			if opts.Timestamp != nil {
+				now = opts.Timestamp(item)
+			}
+
+			// every partial match, and a new one, gets a chance to advance
+			current := append(partials[item.Key], &partialMatch[K, V]{started: now})
+			next := make([]*partialMatch[K, V], 0, len(current))
+			var found *partialMatch[K, V]
+			for _, pm := range current {
+				if expired(pm, now) {
+					continue
+				}
+
+				advanced := advance(pm, item)
+				if advanced == nil {
+					if len(pm.events) > 0 {
+						next = append(next, pm)
+					}
+					continue
+				}
+
+				if complete(advanced.next) {
+					found = advanced
+					break
+				}
+				next = append(next, advanced)
+			}
+
+			if found != nil {
+				delete(partials, item.Key)
+				if !emit(Item[K, Match[K, V]]{Key: item.Key, Value: p.match(found)}) {
+					return
+				}
+			} else if len(next) == 0 {
+				delete(partials, item.Key)
+			} else {
+				if len(next) > limit {
+					next = next[len(next)-limit:]
+				}
+				partials[item.Key] = next
+			}
+
+			// the keys that went quiet are swept now and then, so that
+			// their expired partial matches do not pile up
+			if seen++; p.within > 0 && seen%1024 == 0 {
+				for key, pms := range partials {
+					if expired(pms[len(pms)-1], now) {
+						delete(partials, key)
+					}
+				}
+			}
+		}
+	})
+}
+
+func (p *Pattern[K, V]) match(pm *partialMatch[K, V]) Match[K, V] {
+	m := Match[K, V]{Events: pm.events, Steps: make(map[string][]Item[K, V])}
+	for i, step := range pm.steps {
+		name := p.steps[step].name
+		m.Steps[name] = append(m.Steps[name], pm.events[i])
+	}
+	return m
+}
@@ -0,0 +1,125 @@
+package superstream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userEvent struct {
+	Kind   string
+	Minute int
+}
+
+func Test_MatchPattern(t *testing.T) {
+	type event = stream.Item[string, userEvent]
+
+	t0 := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	opts := stream.PatternOptions[string, userEvent]{
+		Timestamp: func(e event) time.Time { return t0.Add(time.Duration(e.Value.Minute) * time.Minute) },
+	}
+	kind := func(k string) func(event) bool {
+		return func(e event) bool { return e.Value.Kind == k }
+	}
+	events := func(key string, kinds ...string) []event {
+		result := make([]event, 0, len(kinds))
+		for i, k := range kinds {
+			result = append(result, event{Key: key, Value: userEvent{Kind: k, Minute: i}})
+		}
+		return result
+	}
+	t.Run("failures followed by a success", func(t *testing.T) {
+		pattern := func() *stream.Pattern[string, userEvent] {
+			return stream.Begin("failed", kind("failed")).Times(3).
+				FollowedBy("success", kind("success")).
+				Within(5 * time.Minute)
+		}
+
+		var in []event
+		in = append(in, events("ann", "failed", "failed", "view", "failed", "success")...)
+		in = append(in, events("bob", "failed", "failed", "success")...)
+		in = append(in, event{Key: "cid", Value: userEvent{"failed", 0}},
+			event{Key: "cid", Value: userEvent{"failed", 1}},
+			event{Key: "cid", Value: userEvent{"failed", 2}},
+			event{Key: "cid", Value: userEvent{"success", 10}},
+		)
+
+		matches := collect(stream.MatchPattern(rekeyed(in), pattern(), opts))
+		require.Len(t, matches, 1)
+		assert.Equal(t, "ann", matches[0].Key)
+
+		m := matches[0].Value
+		assert.Len(t, m.Events, 4)
+		assert.Len(t, m.Steps["failed"], 3)
+		assert.Equal(t, []event{{Key: "ann", Value: userEvent{"success", 4}}}, m.Steps["success"])
+	})
+
+	t.Run("optional steps", func(t *testing.T) {
+		pattern := stream.Begin("cart", kind("cart")).
+			FollowedBy("coupon", kind("coupon")).Optional().
+			FollowedBy("paid", kind("paid"))
+
+		var in []event
+		in = append(in, events("ann", "cart", "paid")...)
+		in = append(in, events("bob", "cart", "coupon", "view", "paid")...)
+
+		matches := collect(stream.MatchPattern(rekeyed(in), pattern, opts))
+		require.Len(t, matches, 2)
+		assert.Len(t, matches[0].Value.Events, 2)
+		assert.Empty(t, matches[0].Value.Steps["coupon"])
+		assert.Len(t, matches[1].Value.Events, 3)
+		assert.Len(t, matches[1].Value.Steps["coupon"], 1)
+	})
+
+	t.Run("matches do not overlap", func(t *testing.T) {
+		pattern := stream.Begin("a", kind("a")).FollowedBy("b", kind("b"))
+
+		matches := collect(stream.MatchPattern(rekeyed(events("ann", "a", "a", "b", "b", "a", "b")), pattern, opts))
+		require.Len(t, matches, 2)
+		assert.Equal(t, []string{"a", "b"}, kinds(matches[0].Value.Events))
+		assert.Equal(t, 4, matches[1].Value.Events[0].Value.Minute)
+	})
+
+	t.Run("partial matches are bounded", func(t *testing.T) {
+		pattern := func() *stream.Pattern[string, userEvent] {
+			return stream.Begin("a", kind("a")).Times(3).FollowedBy("b", kind("b"))
+		}
+		in := events("ann", "a", "a", "a", "a", "b")
+
+		assert.Len(t, collect(stream.MatchPattern(rekeyed(in), pattern(), opts)), 1)
+
+		bounded := opts
+		bounded.MaxPartialMatches = 1
+		assert.Empty(t, collect(stream.MatchPattern(rekeyed(in), pattern(), bounded)))
+	})
+}
+
+// rekeyed yields the events in order with their own keys
+func rekeyed(in []stream.Item[string, userEvent]) stream.Iterable[string, userEvent] {
+	return func(ctx context.Context) <-chan stream.Item[string, userEvent] {
+		resultCh := make(chan stream.Item[string, userEvent])
+		go func() {
+			defer close(resultCh)
+			for _, e := range in {
+				select {
+				case resultCh <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return resultCh
+	}
+}
+
+func kinds(in []stream.Item[string, userEvent]) []string {
+	result := make([]string, 0, len(in))
+	for _, e := range in {
+		result = append(result, e.Value.Kind)
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package superstream
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Clock is where the time based operators get the time from,
+	// so that tests can move time forward instead of sleeping.
+	// A nil Clock is SystemClock.
+	Clock interface {
+		Now() time.Time
+		NewTimer(d time.Duration) Timer
+	}
+
+	Timer interface {
+		C() <-chan time.Time
+		Stop() bool
+	}
+
+	systemClock struct{}
+
+	systemTimer struct {
+		t *time.Timer
+	}
+
+	// ManualClock only moves when told to. A timer that is due when the clock
+	// is advanced is delivered synchronously: Advance returns once every due
+	// timer has been received from or stopped, so by the time it returns the
+	// code under test has seen the time move.
+	ManualClock struct {
+		mux     sync.Mutex
+		cond    *sync.Cond
+		now     time.Time
+		timers  []*manualTimer
+		created int
+	}
+
+	manualTimer struct {
+		clock     *ManualClock
+		deadline  time.Time
+		c         chan time.Time
+		stoppedCh chan struct{}
+		fired     bool
+		stopped   bool
+	}
+)
+
+// SystemClock is the clock of the operating system
+var SystemClock Clock = systemClock{}
+
+// clockOrSystem is clock, SystemClock when it is nil
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{t: time.NewTimer(d)}
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t *systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	c := &ManualClock{now: now}
+	c.cond = sync.NewCond(&c.mux)
+	return c
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	t := &manualTimer{
+		clock:     c,
+		deadline:  c.now.Add(d),
+		c:         make(chan time.Time),
+		stoppedCh: make(chan struct{}),
+	}
+	c.timers = append(c.timers, t)
+	c.created++
+	c.cond.Broadcast()
+	return t
+}
+
+// BlockUntilTimers waits until at least n timers have been created since the clock was
+func (c *ManualClock) BlockUntilTimers(n int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for c.created < n {
+		c.cond.Wait()
+	}
+}
+
+// Advance moves the clock forward by d and delivers every timer that is due, earliest first
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+
+	var due, pending []*manualTimer
+	for _, t := range c.timers {
+		if !t.deadline.After(now) {
+			t.fired = true
+			due = append(due, t)
+		} else {
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.mux.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].deadline.Before(due[j].deadline) })
+	for _, t := range due {
+		select {
+		case t.c <- now:
+		case <-t.stoppedCh:
+		}
+	}
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if t.stopped {
+		return false
+	}
+	t.stopped = true
+	close(t.stoppedCh)
+
+	if t.fired {
+		return false
+	}
+
+	for i := range c.timers {
+		if c.timers[i] == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			break
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package superstream
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+type (
+	Encoder[T any] interface {
+		Encode(v T) error
+	}
+
+	// Decoder returns io.EOF once there is nothing left to decode
+	Decoder[T any] interface {
+		Decode() (T, error)
+	}
+
+	// Codec turns a stream of values into bytes and back
+	Codec[T any] interface {
+		NewEncoder(w io.Writer) Encoder[T]
+		NewDecoder(r io.Reader) Decoder[T]
+	}
+
+	jsonCodec[T any] struct{}
+	gobCodec[T any]  struct{}
+
+	jsonEncoder[T any] struct{ enc *json.Encoder }
+	jsonDecoder[T any] struct{ dec *json.Decoder }
+	gobEncoder[T any]  struct{ enc *gob.Encoder }
+	gobDecoder[T any]  struct{ dec *gob.Decoder }
+)
+
+// JSONCodec encodes values as newline delimited JSON
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+// GobCodec encodes values as a gob stream
+func GobCodec[T any]() Codec[T] {
+	return gobCodec[T]{}
+}
+
+func (jsonCodec[T]) NewEncoder(w io.Writer) Encoder[T] {
+	return jsonEncoder[T]{enc: json.NewEncoder(w)}
+}
+
+func (jsonCodec[T]) NewDecoder(r io.Reader) Decoder[T] {
+	return jsonDecoder[T]{dec: json.NewDecoder(r)}
+}
+
+func (e jsonEncoder[T]) Encode(v T) error {
+	return e.enc.Encode(v)
+}
+
+func (d jsonDecoder[T]) Decode() (T, error) {
+	var v T
+	err := d.dec.Decode(&v)
+	return v, err
+}
+
+func (gobCodec[T]) NewEncoder(w io.Writer) Encoder[T] {
+	return gobEncoder[T]{enc: gob.NewEncoder(w)}
+}
+
+func (gobCodec[T]) NewDecoder(r io.Reader) Decoder[T] {
+	return gobDecoder[T]{dec: gob.NewDecoder(r)}
+}
+
+func (e gobEncoder[T]) Encode(v T) error {
+	return e.enc.Encode(v)
+}
+
+func (d gobDecoder[T]) Decode() (T, error) {
+	var v T
+	err := d.dec.Decode(&v)
+	return v, err
+}
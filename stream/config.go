@@ -0,0 +1,449 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfig = errors.New("invalid pipeline config")
+
+type (
+	// ConfigError holds all the problems LoadPipeline found in a config,
+	// every one of them is an ErrInvalidConfig
+	ConfigError []error
+
+	// configLineError is a problem at a line of a config, err is what is
+	// wrong there, such as an ErrTypeMismatch
+	configLineError struct {
+		line int
+		err  error
+	}
+
+	// Registry holds the sources, mappers, reducers and sinks
+	// a pipeline config can refer to by name
+	Registry struct {
+		stages map[registryKey]registered
+	}
+
+	registryKey struct {
+		kind stageKind
+		name string
+	}
+
+	// registered adds a stage of what it was registered with to a graph,
+	// returning the *Result of reducers
+	registered func(g *Graph, stage string, options []reducerOption) any
+
+	// Pipeline is a graph built from a config, ready to run
+	Pipeline struct {
+		Graph   *Graph
+		results map[string]any
+	}
+
+	// stageConfig is a stage of a config, with the line it starts at
+	stageConfig struct {
+		line    int
+		name    string
+		kind    stageKind
+		ref     string
+		inputs  []*yaml.Node
+		options []reducerOption
+		retries int
+		backoff time.Duration
+	}
+)
+
+func NewRegistry() *Registry {
+	return &Registry{stages: make(map[registryKey]registered)}
+}
+
+// RegisterSource makes the iterable available to configs as a source under name
+func RegisterSource[K, V any](r *Registry, name string, iterable Iterable[K, V]) {
+	r.register(sourceStage, name, func(g *Graph, stage string, _ []reducerOption) any {
+		AddSource(g, stage, iterable)
+		return nil
+	})
+}
+
+// RegisterMapper makes the mapper available to configs under name
+func RegisterMapper[K comparable, I, O any](r *Registry, name string, m mapper[K, I, O]) {
+	r.register(mapperStage, name, func(g *Graph, stage string, options []reducerOption) any {
+		AddMapper(g, stage, m, options...)
+		return nil
+	})
+}
+
+// RegisterReducer makes the reducer available to configs under name, every
+// stage using it starts from initialReducerValue
+func RegisterReducer[K comparable, V, R any](r *Registry, name string, red reducer[K, R, V], initialReducerValue R) {
+	r.register(reducerStage, name, func(g *Graph, stage string, options []reducerOption) any {
+		return AddReducer(g, stage, red, initialReducerValue, options...)
+	})
+}
+
+// RegisterSink makes the sinks newSink creates available to configs under name,
+// every stage using it gets a sink of its own
+func RegisterSink[K comparable, V any](r *Registry, name string, newSink func() Sink[K, V]) {
+	r.register(sinkStage, name, func(g *Graph, stage string, options []reducerOption) any {
+		AddSink(g, stage, newSink(), options...)
+		return nil
+	})
+}
+
+// register panics when name is taken by another stage of the same kind,
+// registering twice is a mistake in the program, not in a config
+func (r *Registry) register(kind stageKind, name string, add registered) {
+	key := registryKey{kind: kind, name: name}
+	if _, found := r.stages[key]; found {
+		panic(fmt.Sprintf("%s %q is already registered", kind, name))
+	}
+	r.stages[key] = add
+}
+
+// LoadPipelineFile loads the pipeline config in the file at path, see LoadPipeline
+func LoadPipelineFile(path string, reg *Registry) (*Pipeline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadPipeline(f, reg)
+}
+
+// LoadPipeline builds a pipeline from a YAML config of its stages, which refer
+// to what is registered with reg by name:
+//
+//	stages:
+//	  - name: orders
+//	    source: orders
+//	  - name: enrich
+//	    mapper: enrich
+//	    inputs: [orders]
+//	    concurrency: 8
+//	    error_threshold: 10
+//	    retries: 3
+//	    retry_backoff: 100ms
+//	    chunk_size: 16
+//	  - name: revenue
+//	    reducer: sum
+//	    inputs: [enrich]
+//
+// Every stage has a name and one of source, mapper, reducer or sink. Stages
+// other than sources take inputs and the options of MapReduce. All the problems
+// found in the config are returned together in a ConfigError, each with the
+// line it is at.
+func LoadPipeline(r io.Reader, reg *Registry) (*Pipeline, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ConfigError{fmt.Errorf("%w: the config is empty", ErrInvalidConfig)}
+		}
+		return nil, ConfigError{fmt.Errorf("%w: %v", ErrInvalidConfig, err)}
+	}
+
+	var errs ConfigError
+	failAt := func(line int, err error) {
+		errs = append(errs, &configLineError{line: line, err: err})
+	}
+	fail := func(node *yaml.Node, format string, args ...any) {
+		failAt(node.Line, fmt.Errorf(format, args...))
+	}
+
+	root := doc.Content[0]
+	var stagesNode *yaml.Node
+	if root.Kind != yaml.MappingNode {
+		fail(root, "expected a mapping with stages")
+		return nil, errs
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != "stages" {
+			fail(key, "unknown field %q", key.Value)
+			continue
+		}
+		stagesNode = value
+	}
+
+	if stagesNode == nil || stagesNode.Kind != yaml.SequenceNode || len(stagesNode.Content) == 0 {
+		if stagesNode == nil {
+			stagesNode = root
+		}
+		fail(stagesNode, "expected a list of stages")
+		return nil, errs
+	}
+
+	var stages []*stageConfig
+	lines := make(map[string]int)
+	for _, node := range stagesNode.Content {
+		sc := parseStage(node, fail)
+		if sc == nil {
+			continue
+		}
+
+		if line, found := lines[sc.name]; found {
+			fail(node, "stage %q is already defined at line %d", sc.name, line)
+			continue
+		}
+		lines[sc.name] = sc.line
+		stages = append(stages, sc)
+	}
+
+	for _, sc := range stages {
+		for _, in := range sc.inputs {
+			if _, found := lines[in.Value]; !found {
+				fail(in, "stage %q: unknown input %q", sc.name, in.Value)
+			}
+		}
+
+		if _, found := reg.stages[registryKey{kind: sc.kind, name: sc.ref}]; !found {
+			failAt(sc.line, fmt.Errorf("stage %q: no %s is registered as %q", sc.name, sc.kind, sc.ref))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	p := &Pipeline{Graph: NewGraph(), results: make(map[string]any)}
+	for _, sc := range stages {
+		options := sc.options
+		if sc.retries > 0 {
+			options = append(options, WithRetries(sc.retries, sc.backoff))
+		}
+
+		if result := reg.stages[registryKey{kind: sc.kind, name: sc.ref}](p.Graph, sc.name, options); result != nil {
+			p.results[sc.name] = result
+		}
+
+		for _, in := range sc.inputs {
+			p.Graph.Connect(in.Value, sc.name)
+		}
+	}
+
+	checkEdges(p.Graph, stages, failAt)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// the checks above cover what Validate looks for, this is only a safety net
+	if err := p.Graph.Validate(); err != nil {
+		return nil, ConfigError{fmt.Errorf("%w: %v", ErrInvalidConfig, err)}
+	}
+
+	return p, nil
+}
+
+// checkEdges does what Graph.Validate does for the graph built from a config,
+// so that every problem comes with the line of the input or stage it is about
+func checkEdges(g *Graph, stages []*stageConfig, failAt func(line int, err error)) {
+	consumed := make(map[string]bool)
+	for _, sc := range stages {
+		to := g.stages[sc.name]
+		for _, in := range sc.inputs {
+			from := g.stages[in.Value]
+			consumed[in.Value] = true
+
+			switch {
+			case from.out == nil:
+				failAt(in.Line, fmt.Errorf("stage %q: %w: input %q is a %s, which has no output", sc.name, ErrDanglingPort, in.Value, from.kind))
+			case from.out != to.in:
+				failAt(in.Line, fmt.Errorf(
+					"stage %q: %w: input %q produces %s but %q consumes %s",
+					sc.name, ErrTypeMismatch, in.Value, from.out, sc.name, to.in,
+				))
+			}
+		}
+	}
+
+	lines := make(map[string]int, len(stages))
+	for _, sc := range stages {
+		lines[sc.name] = sc.line
+		if g.stages[sc.name].out != nil && !consumed[sc.name] {
+			failAt(sc.line, fmt.Errorf("stage %q: %w: no stage takes the output of %s %q", sc.name, ErrDanglingPort, sc.kind, sc.name))
+		}
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		failAt(lines[cycle[0]], fmt.Errorf("stage %q: %w: %s", cycle[0], ErrCycle, strings.Join(cycle, " -> ")))
+	}
+}
+
+// parseStage checks a stage of the config against the schema,
+// it returns nil when the stage is too broken to go on with
+func parseStage(node *yaml.Node, fail func(node *yaml.Node, format string, args ...any)) *stageConfig {
+	if node.Kind != yaml.MappingNode {
+		fail(node, "expected a stage")
+		return nil
+	}
+
+	sc := &stageConfig{line: node.Line}
+	var kindNode *yaml.Node
+	var backoffNode *yaml.Node
+	hasOptions := false
+
+	positive := func(key, value *yaml.Node) (int, bool) {
+		var n int
+		if value.Kind != yaml.ScalarNode || value.Tag != "!!int" || value.Decode(&n) != nil || n <= 0 {
+			fail(value, "%s must be a positive integer, got %q", key.Value, value.Value)
+			return 0, false
+		}
+		return n, true
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "name":
+			if value.Kind != yaml.ScalarNode || value.Value == "" {
+				fail(value, "name must be a non empty string")
+				continue
+			}
+			sc.name = value.Value
+		case "source", "mapper", "reducer", "sink":
+			if kindNode != nil {
+				fail(key, "a stage is one of source, mapper, reducer or sink, not both %s and %s", kindNode.Value, key.Value)
+				continue
+			}
+			if value.Kind != yaml.ScalarNode || value.Value == "" {
+				fail(value, "%s must be the name it is registered with", key.Value)
+				continue
+			}
+			kindNode, sc.ref = key, value.Value
+		case "inputs":
+			if value.Kind != yaml.SequenceNode {
+				fail(value, "inputs must be a list of stage names")
+				continue
+			}
+			listed := make(map[string]int)
+			for _, in := range value.Content {
+				if in.Kind != yaml.ScalarNode {
+					fail(in, "inputs must be a list of stage names")
+					continue
+				}
+				if line, found := listed[in.Value]; found {
+					fail(in, "input %q is already listed at line %d", in.Value, line)
+					continue
+				}
+				listed[in.Value] = in.Line
+				sc.inputs = append(sc.inputs, in)
+			}
+		case "concurrency":
+			hasOptions = true
+			if n, ok := positive(key, value); ok {
+				sc.options = append(sc.options, WithConcurrency(n))
+			}
+		case "error_threshold":
+			hasOptions = true
+			if n, ok := positive(key, value); ok {
+				sc.options = append(sc.options, ErrorThreshold(n))
+			}
+		case "chunk_size":
+			hasOptions = true
+			if n, ok := positive(key, value); ok {
+				sc.options = append(sc.options, WithChunkSize(n))
+			}
+		case "retries":
+			hasOptions = true
+			if n, ok := positive(key, value); ok {
+				sc.retries = n
+			}
+		case "retry_backoff":
+			hasOptions = true
+			backoffNode = value
+			d, err := time.ParseDuration(value.Value)
+			if value.Kind != yaml.ScalarNode || err != nil || d < 0 {
+				fail(value, "retry_backoff must be a duration such as 100ms, got %q", value.Value)
+				continue
+			}
+			sc.backoff = d
+		default:
+			fail(key, "unknown field %q", key.Value)
+		}
+	}
+
+	if sc.name == "" {
+		fail(node, "stage without a name")
+		return nil
+	}
+
+	if kindNode == nil {
+		fail(node, "stage %q: expected one of source, mapper, reducer or sink", sc.name)
+		return nil
+	}
+
+	switch kindNode.Value {
+	case "source":
+		sc.kind = sourceStage
+		if len(sc.inputs) > 0 || hasOptions {
+			fail(node, "stage %q: a source takes neither inputs nor options", sc.name)
+		}
+	case "mapper":
+		sc.kind = mapperStage
+	case "reducer":
+		sc.kind = reducerStage
+	default:
+		sc.kind = sinkStage
+	}
+
+	if sc.kind != sourceStage && len(sc.inputs) == 0 {
+		fail(node, "stage %q: a %s needs inputs", sc.name, sc.kind)
+	}
+
+	if backoffNode != nil && sc.retries == 0 {
+		fail(backoffNode, "stage %q: retry_backoff without retries", sc.name)
+	}
+
+	return sc
+}
+
+func (cErr ConfigError) Error() string {
+	return joinErrors("config", cErr)
+}
+
+// Is reports whether any of the collected errors matches target
+func (cErr ConfigError) Is(target error) bool {
+	return anyErrorIs(cErr, target)
+}
+
+// As finds the first of the collected errors that matches target
+func (cErr ConfigError) As(target any) bool {
+	return anyErrorAs(cErr, target)
+}
+
+func (lErr *configLineError) Error() string {
+	return fmt.Sprintf("%s: line %d: %s", ErrInvalidConfig, lErr.line, lErr.err)
+}
+
+// Is makes every problem at a line an ErrInvalidConfig
+func (lErr *configLineError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+func (lErr *configLineError) Unwrap() error {
+	return lErr.err
+}
+
+// Run runs the pipeline, see Graph.Run
+func (p *Pipeline) Run(ctx context.Context) error {
+	return p.Graph.Run(ctx)
+}
+
+// PipelineResult returns the result of the reducer stage of the pipeline,
+// false if there is no such stage or its result is not an R
+func PipelineResult[R any](p *Pipeline, stage string) (R, bool) {
+	result, ok := p.results[stage].(*Result[R])
+	if !ok {
+		return Zero[R](), false
+	}
+
+	return result.Value(), true
+}
@@ -0,0 +1,194 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRegistry() *stream.Registry {
+	reg := stream.NewRegistry()
+	stream.RegisterSource(reg, "numbers", stream.Slice([]int{1, 2, 3, 4}))
+	stream.RegisterSource(reg, "words", stream.Slice([]string{"a"}))
+	stream.RegisterMapper(reg, "double", func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+		return stream.Item[int, int]{Key: item.Key, Value: item.Value * 2}, nil
+	})
+	stream.RegisterMapper(reg, "flaky", flakyMapper(1))
+	stream.RegisterReducer(reg, "sum", func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+		return acc + item.Value, nil
+	}, 0)
+	return reg
+}
+
+func Test_LoadPipeline(t *testing.T) {
+	t.Run("runs the configured stages", func(t *testing.T) {
+		config := `
+stages:
+  - name: numbers
+    source: numbers
+  - name: doubled
+    mapper: double
+    inputs: [numbers]
+    concurrency: 4
+    chunk_size: 2
+  - name: retried
+    mapper: flaky
+    inputs: [doubled]
+    retries: 2
+    retry_backoff: 1ms
+    error_threshold: 1
+  - name: total
+    reducer: sum
+    inputs: [retried]
+  - name: raw
+    reducer: sum
+    inputs: [numbers]
+`
+		p, err := stream.LoadPipeline(strings.NewReader(config), testRegistry())
+		require.NoError(t, err)
+		require.NoError(t, p.Run(context.Background()))
+
+		total, ok := stream.PipelineResult[int](p, "total")
+		require.True(t, ok)
+		assert.Equal(t, 20, total)
+
+		raw, ok := stream.PipelineResult[int](p, "raw")
+		require.True(t, ok)
+		assert.Equal(t, 10, raw)
+
+		_, ok = stream.PipelineResult[string](p, "total")
+		assert.False(t, ok)
+	})
+
+	t.Run("from a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pipeline.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+stages:
+  - {name: numbers, source: numbers}
+  - {name: total, reducer: sum, inputs: [numbers]}
+`), 0o644))
+
+		p, err := stream.LoadPipelineFile(path, testRegistry())
+		require.NoError(t, err)
+		require.NoError(t, p.Run(context.Background()))
+		total, _ := stream.PipelineResult[int](p, "total")
+		assert.Equal(t, 10, total)
+	})
+
+	t.Run("schema errors with their lines", func(t *testing.T) {
+		config := `stages:
+  - name: numbers
+    source: numbers
+    concurrency: 2
+  - name: doubled
+    mapper: triple
+    inputs: [numbers]
+  - name: total
+    reducer: sum
+    inputs: [doubled, missing]
+    concurency: 4
+  - name: total
+    reducer: sum
+    inputs: [numbers]
+  - name: broken
+    mapper: double
+    sink: double
+    inputs: [numbers]
+    error_threshold: many
+    retry_backoff: soon
+  - mapper: double
+  - name: twice
+    reducer: sum
+    inputs:
+      - numbers
+      - numbers
+`
+		_, err := stream.LoadPipeline(strings.NewReader(config), testRegistry())
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, stream.ErrInvalidConfig))
+
+		msg := err.Error()
+		for _, want := range []string{
+			`line 2: stage "numbers": a source takes neither inputs nor options`,
+			`line 11: unknown field "concurency"`,
+			`line 12: stage "total" is already defined at line 8`,
+			`line 17: a stage is one of source, mapper, reducer or sink, not both mapper and sink`,
+			`line 19: error_threshold must be a positive integer, got "many"`,
+			`line 20: retry_backoff must be a duration such as 100ms, got "soon"`,
+			`line 20: stage "broken": retry_backoff without retries`,
+			`line 21: stage without a name`,
+			`line 26: input "numbers" is already listed at line 25`,
+			`line 10: stage "total": unknown input "missing"`,
+			`line 5: stage "doubled": no mapper is registered as "triple"`,
+		} {
+			assert.Contains(t, msg, want)
+		}
+	})
+
+	t.Run("graph errors with their lines", func(t *testing.T) {
+		_, err := stream.LoadPipeline(strings.NewReader(`
+stages:
+  - {name: words, source: words}
+  - name: total
+    reducer: sum
+    inputs:
+      - words
+`), testRegistry())
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, stream.ErrInvalidConfig))
+		assert.True(t, errors.Is(err, stream.ErrTypeMismatch))
+		assert.ErrorContains(t, err, `line 7: stage "total": type mismatch: input "words" produces`)
+
+		var cErr stream.ConfigError
+		require.True(t, errors.As(err, &cErr))
+		assert.Len(t, cErr, 1)
+
+		_, err = stream.LoadPipeline(strings.NewReader(`
+stages:
+  - {name: numbers, source: numbers}
+  - {name: a, mapper: double, inputs: [numbers, b]}
+  - {name: b, mapper: double, inputs: [a]}
+  - {name: total, reducer: sum, inputs: [b]}
+  - {name: unused, mapper: double, inputs: [numbers]}
+  - {name: again, reducer: sum, inputs: [total]}
+`), testRegistry())
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, stream.ErrInvalidConfig))
+		assert.True(t, errors.Is(err, stream.ErrCycle))
+		assert.True(t, errors.Is(err, stream.ErrDanglingPort))
+
+		msg := err.Error()
+		for _, want := range []string{
+			`line 4: stage "a": cycle: a -> b -> a`,
+			`line 7: stage "unused": dangling port: no stage takes the output of mapper "unused"`,
+			`line 8: stage "again": dangling port: input "total" is a reducer, which has no output`,
+		} {
+			assert.Contains(t, msg, want)
+		}
+	})
+
+	t.Run("malformed yaml", func(t *testing.T) {
+		_, err := stream.LoadPipeline(strings.NewReader("stages: [\n"), testRegistry())
+		assert.True(t, errors.Is(err, stream.ErrInvalidConfig))
+		assert.Contains(t, err.Error(), "line")
+
+		_, err = stream.LoadPipeline(strings.NewReader(""), testRegistry())
+		assert.True(t, errors.Is(err, stream.ErrInvalidConfig))
+
+		_, err = stream.LoadPipeline(strings.NewReader("stage: []"), testRegistry())
+		assert.ErrorContains(t, err, `line 1: unknown field "stage"`)
+	})
+
+	t.Run("registering twice panics", func(t *testing.T) {
+		reg := testRegistry()
+		assert.Panics(t, func() { stream.RegisterSource(reg, "numbers", stream.Slice([]int{1})) })
+		assert.NotPanics(t, func() { stream.RegisterMapper(reg, "numbers", flakyMapper(0)) })
+	})
+}
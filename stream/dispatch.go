@@ -0,0 +1,131 @@
+package superstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// dispatcher hands the items of the source to the mappers in chunks
+type dispatcher[K comparable, I any] interface {
+	// next blocks until there is work for the given worker
+	// and reports false once there is none left
+	next(ctx context.Context, worker int) ([]Item[K, I], bool)
+}
+
+func newDispatcher[K comparable, I any](
+	ctx context.Context,
+	fc *flowControl,
+	tasks *sync.WaitGroup,
+	inCh <-chan Item[K, I],
+) (dispatcher[K, I], error) {
+	if fc.affinity != nil && fc.priority != nil {
+		return nil, fmt.Errorf("%w: WithKeyAffinity and WithPriority cannot be combined", ErrInvalidOption)
+	}
+
+	if fc.priority != nil {
+		priority, err := priorityFunc[K, I](fc)
+		if err != nil {
+			return nil, err
+		}
+		return newPriorityDispatcher(ctx, fc, tasks, sourceDispatcher(ctx, fc, inCh, true), priority), nil
+	}
+
+	if fc.affinity != nil {
+		hash, err := affinityHash[K](fc)
+		if err != nil {
+			return nil, err
+		}
+		return newAffinityDispatcher(ctx, fc, tasks, sourceDispatcher(ctx, fc, inCh, false), hash), nil
+	}
+
+	return sourceDispatcher(ctx, fc, inCh, true), nil
+}
+
+// sourceDispatcher picks the cheapest way to consume inCh. Reading by index
+// is only allowed when the order in which items are handed out does not matter.
+func sourceDispatcher[K comparable, I any](
+	ctx context.Context,
+	fc *flowControl,
+	inCh <-chan Item[K, I],
+	allowRanges bool,
+) dispatcher[K, I] {
+	if allowRanges {
+		if offer, ok := claimRanges(ctx, inCh); ok {
+			return newRangeDispatcher(fc, offer)
+		}
+	}
+
+	chunkCh := make(chan []Item[K, I])
+	if claimChunks(ctx, inCh, chunkClaim[K, I]{chunkCh: chunkCh, size: fc.chunkSize}) {
+		return &chunkDispatcher[K, I]{inCh: inCh, chunkCh: chunkCh}
+	}
+
+	return &itemDispatcher[K, I]{inCh: inCh, chunkSize: fc.chunkSize}
+}
+
+// chunkDispatcher serves sources that write chunks directly.
+// Such a source closes its regular channel only after its last chunk
+// has been received, so a closed inCh means there is nothing left.
+// Until the source notices the claim it may still send an item the
+// regular way, which is why inCh is read and not merely waited on.
+type chunkDispatcher[K comparable, I any] struct {
+	inCh    <-chan Item[K, I]
+	chunkCh chan []Item[K, I]
+}
+
+func (d *chunkDispatcher[K, I]) next(ctx context.Context, _ int) ([]Item[K, I], bool) {
+	select {
+	case chunk := <-d.chunkCh:
+		return chunk, true
+	case item, ok := <-d.inCh:
+		if !ok {
+			return nil, false
+		}
+		return []Item[K, I]{item}, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// itemDispatcher serves any other source: a worker waits for one item
+// and then takes along whatever else is ready, up to a full chunk,
+// so a slow source never makes the mappers wait for a chunk to fill up.
+type itemDispatcher[K comparable, I any] struct {
+	inCh      <-chan Item[K, I]
+	chunkSize int
+}
+
+func (d *itemDispatcher[K, I]) next(ctx context.Context, _ int) ([]Item[K, I], bool) {
+	return gather(ctx, d.inCh, d.chunkSize)
+}
+
+// gather waits for one item of inCh and then takes along
+// whatever else is ready, up to chunkSize items
+func gather[K, I any](ctx context.Context, inCh <-chan Item[K, I], chunkSize int) ([]Item[K, I], bool) {
+	var first Item[K, I]
+	select {
+	case item, ok := <-inCh:
+		if !ok {
+			return nil, false
+		}
+		first = item
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	chunk := []Item[K, I]{first}
+	for len(chunk) < chunkSize {
+		select {
+		case item, ok := <-inCh:
+			if !ok {
+				return chunk, true
+			}
+			chunk = append(chunk, item)
+		default:
+			return chunk, true
+		}
+	}
+
+	return chunk, true
+}
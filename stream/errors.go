@@ -1,20 +1,38 @@
 package superstream
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
 var (
-	ErrSkip = fmt.Errorf("must skip item")
+	ErrSkip          = fmt.Errorf("must skip item")
+	ErrInvalidOption = errors.New("invalid option")
 )
 
 type MapReduceError []error
 
 func (mpErr MapReduceError) Error() string {
+	return joinErrors("map reduce", mpErr)
+}
+
+// Is reports whether any of the collected errors matches target
+func (mpErr MapReduceError) Is(target error) bool {
+	return anyErrorIs(mpErr, target)
+}
+
+// As finds the first of the collected errors that matches target
+func (mpErr MapReduceError) As(target any) bool {
+	return anyErrorAs(mpErr, target)
+}
+
+// joinErrors is the message of every collected error type, such as
+// MapReduceError or GraphError
+func joinErrors(label string, errs []error) string {
 	var b strings.Builder
-	b.WriteString(fmt.Sprintf("%d map reduce errors: ", len(mpErr)))
-	for i, err := range mpErr {
+	b.WriteString(fmt.Sprintf("%d %s errors: ", len(errs), label))
+	for i, err := range errs {
 		if i != 0 {
 			b.WriteString(", ")
 		}
@@ -22,3 +40,45 @@ func (mpErr MapReduceError) Error() string {
 	}
 	return b.String()
 }
+
+func anyErrorIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyErrorAs(errs []error, target any) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PanicError is what a mapper that panicked is reported as, it always
+// ends the run and is returned, whatever the error threshold
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (pErr *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", pErr.Value)
+}
+
+// appendError adds err to whatever MapReduce returned
+func appendError(mrErr error, err error) error {
+	if mrErr == nil {
+		return MapReduceError{err}
+	}
+
+	if mpErr, ok := mrErr.(MapReduceError); ok {
+		return append(mpErr, err)
+	}
+
+	return MapReduceError{mrErr, err}
+}
@@ -0,0 +1,159 @@
+package superstream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type (
+	// Window is a tumbling window of event time, holding the items of Key
+	// with a timestamp in [Start, End)
+	Window[K any] struct {
+		Key        K
+		Start, End time.Time
+	}
+
+	// EventTime configures EventTimeWindows
+	EventTime[K, V any] struct {
+		// Timestamp tells when the item happened
+		Timestamp func(Item[K, V]) time.Time
+		// Size is the length of the windows
+		Size time.Duration
+		// OutOfOrderness is how far behind the latest timestamp seen so far items
+		// are still expected to arrive, the watermark trails the latest timestamp by it
+		OutOfOrderness time.Duration
+		// AllowedLateness is how long past the watermark a fired window is kept,
+		// an item arriving for it in that time fires it once again
+		AllowedLateness time.Duration
+		// Late receives the items that arrive after their window is gone,
+		// nil drops them. It is closed once the stream is over.
+		Late Sink[K, V]
+	}
+
+	windowID[K comparable] struct {
+		key   K
+		start int64
+	}
+
+	windowState[K comparable, V any] struct {
+		window Window[K]
+		items  []Item[K, V]
+		seq    int
+		fired  bool
+	}
+)
+
+// EventTimeWindows groups the items of every key into tumbling windows of their
+// event time, which may arrive out of order. A window fires, that is emitted with
+// all of its items in arrival order, once the watermark passes its end. Windows
+// that fire together are emitted by their start, then in the order they were opened.
+// Late items still within the allowed lateness fire their window again with
+// the item included, later ones go to the Late sink. Whatever has not fired yet
+// fires once the source is exhausted. Failing to write to the Late sink ends
+// the stream and the running MapReduce gets the error, as does a config
+// without a Timestamp or a positive Size, as an ErrInvalidOption.
+func EventTimeWindows[K comparable, V any](iterable Iterable[K, V], et EventTime[K, V]) Iterable[Window[K], []Item[K, V]] {
+	type out = Item[Window[K], []Item[K, V]]
+
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(out) bool) {
+		if et.Late != nil {
+			defer func() {
+				if err := et.Late.Close(); err != nil {
+					reportSourceError(ctx, fmt.Errorf("late sink close error: %w", err))
+				}
+			}()
+		}
+
+		if et.Timestamp == nil || et.Size <= 0 {
+			reportSourceError(ctx, fmt.Errorf("%w: EventTimeWindows needs a Timestamp and a positive Size, got a Size of %s", ErrInvalidOption, et.Size))
+			return
+		}
+
+		windows := make(map[windowID[K]]*windowState[K, V])
+		var watermark time.Time
+		var seen bool
+		seq := 0
+
+		fire := func(w *windowState[K, V]) bool {
+			w.fired = true
+			items := make([]Item[K, V], len(w.items))
+			copy(items, w.items)
+			return emit(out{Key: w.window, Value: items})
+		}
+
+		// advance fires the windows the watermark has passed and forgets
+		// the ones that are past the allowed lateness too
+		advance := func(final bool) bool {
+			var due []*windowState[K, V]
+			for id, w := range windows {
+				if final || !w.window.End.After(watermark) {
+					if !w.fired {
+						due = append(due, w)
+					}
+					if final || !w.window.End.Add(et.AllowedLateness).After(watermark) {
+						delete(windows, id)
+					}
+				}
+			}
+
+			sort.Slice(due, func(i, j int) bool {
+				if !due[i].window.Start.Equal(due[j].window.Start) {
+					return due[i].window.Start.Before(due[j].window.Start)
+				}
+				return due[i].seq < due[j].seq
+			})
+
+			for _, w := range due {
+				if !fire(w) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for item := range inCh {
+			ts := et.Timestamp(item)
+			start := ts.Truncate(et.Size)
+			id := windowID[K]{key: item.Key, start: start.UnixNano()}
+
+			w, ok := windows[id]
+			if !ok && seen && !start.Add(et.Size).Add(et.AllowedLateness).After(watermark) {
+				if et.Late != nil {
+					if err := et.Late.Write(ctx, item); err != nil {
+						reportSourceError(ctx, fmt.Errorf("late sink error: %w", err))
+						return
+					}
+				}
+				continue
+			}
+
+			if !ok {
+				w = &windowState[K, V]{
+					window: Window[K]{Key: item.Key, Start: start, End: start.Add(et.Size)},
+					seq:    seq,
+				}
+				windows[id] = w
+				seq++
+			}
+
+			// a window the watermark has passed already fires right away
+			w.items = append(w.items, item)
+			if seen && !w.window.End.After(watermark) && !fire(w) {
+				return
+			}
+
+			if mark := ts.Add(-et.OutOfOrderness); !seen || mark.After(watermark) {
+				watermark, seen = mark, true
+				if !advance(false) {
+					return
+				}
+			}
+		}
+
+		if ctx.Err() == nil {
+			advance(true)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type event = stream.Item[string, int]
+
+// failingSink fails every write
+type failingSink struct{ closed bool }
+
+func (s *failingSink) Write(context.Context, event) error { return errors.New("sink is down") }
+func (s *failingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func Test_EventTimeWindows(t *testing.T) {
+	t0 := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+
+	// events happened Value seconds after t0
+	events := func(in ...event) stream.Iterable[string, int] {
+		return func(ctx context.Context) <-chan event {
+			resultCh := make(chan event)
+			go func() {
+				defer close(resultCh)
+				for _, e := range in {
+					select {
+					case resultCh <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return resultCh
+		}
+	}
+
+	config := func(late stream.Sink[string, int]) stream.EventTime[string, int] {
+		return stream.EventTime[string, int]{
+			Timestamp:       func(e event) time.Time { return at(e.Value) },
+			Size:            10 * time.Second,
+			OutOfOrderness:  2 * time.Second,
+			AllowedLateness: 5 * time.Second,
+			Late:            late,
+		}
+	}
+
+	t.Run("windows fire as the watermark passes them", func(t *testing.T) {
+		lateCh := make(chan event, 10)
+		windows := collect(stream.EventTimeWindows(events(
+			event{Key: "a", Value: 1},
+			event{Key: "b", Value: 3},
+			event{Key: "a", Value: 12},
+			event{Key: "a", Value: 8},
+			event{Key: "a", Value: 16},
+			event{Key: "a", Value: 18},
+			event{Key: "a", Value: 5},
+			event{Key: "b", Value: 9},
+		), config(stream.ChanSink(lateCh))))
+
+		window := func(key string, start int) stream.Window[string] {
+			return stream.Window[string]{Key: key, Start: at(start), End: at(start + 10)}
+		}
+		values := func(key string, vs ...int) []event {
+			result := make([]event, 0, len(vs))
+			for _, v := range vs {
+				result = append(result, event{Key: key, Value: v})
+			}
+			return result
+		}
+
+		assert.Equal(t, []stream.Item[stream.Window[string], []event]{
+			{Key: window("a", 0), Value: values("a", 1)},
+			{Key: window("b", 0), Value: values("b", 3)},
+			{Key: window("a", 0), Value: values("a", 1, 8)},
+			{Key: window("a", 10), Value: values("a", 12, 16, 18)},
+		}, windows)
+
+		var late []event
+		for e := range lateCh {
+			late = append(late, e)
+		}
+		assert.Equal(t, []event{{Key: "a", Value: 5}, {Key: "b", Value: 9}}, late)
+	})
+
+	t.Run("late items are dropped without a sink", func(t *testing.T) {
+		windows := collect(stream.EventTimeWindows(events(
+			event{Key: "a", Value: 1},
+			event{Key: "a", Value: 30},
+			event{Key: "a", Value: 2},
+		), config(nil)))
+
+		require.Len(t, windows, 2)
+		assert.Equal(t, at(0), windows[0].Key.Start)
+		assert.Equal(t, at(30), windows[1].Key.Start)
+	})
+
+	t.Run("late sink errors reach MapReduce", func(t *testing.T) {
+		sink := &failingSink{}
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.EventTimeWindows(events(
+				event{Key: "a", Value: 1},
+				event{Key: "a", Value: 30},
+				event{Key: "a", Value: 2},
+			), config(sink)),
+			func(_ context.Context, w stream.Item[stream.Window[string], []event]) (stream.Item[stream.Window[string], []event], error) {
+				return w, nil
+			},
+			func(_ context.Context, acc int, _ stream.Item[stream.Window[string], []event]) (int, error) {
+				return acc + 1, nil
+			},
+			0,
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "sink is down")
+		assert.True(t, sink.closed)
+	})
+	t.Run("a config without a Timestamp or a positive Size is an invalid option", func(t *testing.T) {
+		noTimestamp := config(nil)
+		noTimestamp.Timestamp = nil
+		noSize := config(nil)
+		noSize.Size = 0
+		negativeSize := config(nil)
+		negativeSize.Size = -time.Second
+
+		for name, et := range map[string]stream.EventTime[string, int]{
+			"no timestamp":  noTimestamp,
+			"no size":       noSize,
+			"negative size": negativeSize,
+		} {
+			_, err := stream.MapReduce(
+				context.TODO(),
+				stream.EventTimeWindows(events(event{Key: "a", Value: 1}), et),
+				func(_ context.Context, w stream.Item[stream.Window[string], []event]) (stream.Item[stream.Window[string], []event], error) {
+					return w, nil
+				},
+				func(_ context.Context, acc int, _ stream.Item[stream.Window[string], []event]) (int, error) {
+					return acc + 1, nil
+				},
+				0,
+			)
+			assert.True(t, errors.Is(err, stream.ErrInvalidOption), name)
+		}
+	})
+}
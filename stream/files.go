@@ -0,0 +1,272 @@
+package superstream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SkipSymlinks leaves symbolic links out of the walk
+	SkipSymlinks SymlinkPolicy = iota
+	// YieldSymlinks yields symbolic links as they are, without following them
+	YieldSymlinks
+	// FollowSymlinks yields what symbolic links point to and walks into the
+	// directories they point to, unless that would walk in circles
+	FollowSymlinks
+)
+
+type (
+	SymlinkPolicy int
+
+	// WalkOptions configures WalkDir. Patterns have the syntax of filepath.Match,
+	// a pattern with a separator in it is matched against the path relative to
+	// the root, one without against the name only.
+	WalkOptions struct {
+		// Include keeps the files that match any of the patterns, all of them when empty
+		Include []string
+		// Exclude leaves out the files and the directories that match any of the
+		// patterns, excluded directories are not walked into
+		Exclude []string
+		// MaxDepth limits how deep the walk goes, 1 only yields what is right in
+		// the root, zero does not limit it
+		MaxDepth int
+		Symlinks SymlinkPolicy
+		// Dirs yields the directories too, Include does not apply to them
+		Dirs bool
+	}
+
+	// FileChunk is a part of a file that ends right after a newline, or at the end of the file
+	FileChunk struct {
+		Path   string
+		Offset int64
+		Length int64
+	}
+)
+
+// WalkDir yields the files under root, keyed by their path, in lexical order.
+// Errors reading a directory are handed to the running MapReduce and the walk
+// goes on without that directory.
+func WalkDir(root string, opts WalkOptions) Iterable[string, fs.DirEntry] {
+	return func(ctx context.Context) <-chan Item[string, fs.DirEntry] {
+		resultCh := make(chan Item[string, fs.DirEntry])
+		go func() {
+			defer close(resultCh)
+
+			info, err := os.Stat(root)
+			if err != nil {
+				reportSourceError(ctx, fmt.Errorf("walk error: %w", err))
+				return
+			}
+
+			w := &walker{ctx: ctx, root: root, opts: opts, resultCh: resultCh}
+			w.walk(root, 1, []os.FileInfo{info})
+		}()
+		return resultCh
+	}
+}
+
+type walker struct {
+	ctx      context.Context
+	root     string
+	opts     WalkOptions
+	resultCh chan<- Item[string, fs.DirEntry]
+}
+
+// walk yields what is in dir, ancestors are the directories walked into to
+// get there, dir included, which is how following a link in circles is noticed
+func (w *walker) walk(dir string, depth int, ancestors []os.FileInfo) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		reportSourceError(w.ctx, fmt.Errorf("walk error: %w", err))
+		return true
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		rel, err := filepath.Rel(w.root, path)
+		if err != nil {
+			rel = path
+		}
+
+		if w.matches(w.opts.Exclude, rel, entry.Name()) {
+			continue
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			switch w.opts.Symlinks {
+			case SkipSymlinks:
+				continue
+			case YieldSymlinks:
+				if !w.yieldFile(path, rel, entry) {
+					return false
+				}
+				continue
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				reportSourceError(w.ctx, fmt.Errorf("walk error: %w", err))
+				continue
+			}
+
+			entry = fs.FileInfoToDirEntry(info)
+			if info.IsDir() && seenDir(ancestors, info) {
+				continue
+			}
+		}
+
+		if !entry.IsDir() {
+			if !w.yieldFile(path, rel, entry) {
+				return false
+			}
+			continue
+		}
+
+		if w.opts.Dirs && !w.yield(path, entry) {
+			return false
+		}
+
+		if w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			reportSourceError(w.ctx, fmt.Errorf("walk error: %w", err))
+			continue
+		}
+
+		if !w.walk(path, depth+1, append(ancestors[:len(ancestors):len(ancestors)], info)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *walker) yieldFile(path, rel string, entry fs.DirEntry) bool {
+	if len(w.opts.Include) > 0 && !w.matches(w.opts.Include, rel, entry.Name()) {
+		return true
+	}
+
+	return w.yield(path, entry)
+}
+
+func (w *walker) yield(path string, entry fs.DirEntry) bool {
+	select {
+	case w.resultCh <- Item[string, fs.DirEntry]{Key: path, Value: entry}:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+func (w *walker) matches(patterns []string, rel, name string) bool {
+	for _, pattern := range patterns {
+		target := name
+		if strings.ContainsRune(pattern, filepath.Separator) || strings.ContainsRune(pattern, '/') {
+			target = filepath.ToSlash(rel)
+			pattern = filepath.ToSlash(pattern)
+		}
+
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func seenDir(ancestors []os.FileInfo, info os.FileInfo) bool {
+	for _, a := range ancestors {
+		if os.SameFile(a, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileChunks splits the file at path into chunks of about size bytes, keyed by
+// their number, every chunk but the last ends right after a newline, so the
+// chunks of a big file of lines can be mapped in parallel. A line longer
+// than size makes its chunk longer.
+func FileChunks(path string, size int64) Iterable[int, FileChunk] {
+	return func(ctx context.Context) <-chan Item[int, FileChunk] {
+		resultCh := make(chan Item[int, FileChunk])
+		go func() {
+			defer close(resultCh)
+
+			if err := chunkFile(ctx, path, size, resultCh); err != nil {
+				reportSourceError(ctx, fmt.Errorf("file chunks error: %w", err))
+			}
+		}()
+		return resultCh
+	}
+}
+
+func chunkFile(ctx context.Context, path string, size int64, resultCh chan<- Item[int, FileChunk]) error {
+	if size <= 0 {
+		return fmt.Errorf("%w: chunk size must be positive, got %d", ErrInvalidOption, size)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for n := 0; offset < info.Size(); n++ {
+		end := offset + size
+		if end < info.Size() {
+			// the chunk goes on up to the end of the line it stops in
+			r := bufio.NewReader(io.NewSectionReader(f, end-1, info.Size()-end+1))
+			line, err := r.ReadSlice('\n')
+			for errors.Is(err, bufio.ErrBufferFull) {
+				end += int64(len(line))
+				line, err = r.ReadSlice('\n')
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			end += int64(len(line)) - 1
+		} else {
+			end = info.Size()
+		}
+
+		select {
+		case resultCh <- Item[int, FileChunk]{Key: n, Value: FileChunk{Path: path, Offset: offset, Length: end - offset}}:
+		case <-ctx.Done():
+			return nil
+		}
+		offset = end
+	}
+
+	return nil
+}
+
+// Read reads the chunk from its file
+func (c FileChunk) Read() ([]byte, error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, c.Length)
+	if _, err := f.ReadAt(b, c.Offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,163 @@
+package superstream_test
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WalkDir(t *testing.T) {
+	root := t.TempDir()
+	for _, file := range []string{"a.txt", "b.log", "skip.tmp", "sub/c.txt", "sub/deep/d.txt", "node_modules/x.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(file), 0o644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "loop"), 0o755))
+	require.NoError(t, os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "filelink.txt")))
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "loop", "back")))
+
+	walk := func(opts stream.WalkOptions) []string {
+		var paths []string
+		for _, item := range collect(stream.WalkDir(root, opts)) {
+			rel, err := filepath.Rel(root, item.Key)
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Base(item.Key), item.Value.Name())
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return paths
+	}
+
+	t.Run("files in lexical order", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"a.txt", "b.log", "node_modules/x.txt", "skip.tmp", "sub/c.txt", "sub/deep/d.txt",
+		}, walk(stream.WalkOptions{}))
+	})
+
+	t.Run("include and exclude", func(t *testing.T) {
+		assert.Equal(t, []string{"a.txt", "sub/c.txt"}, walk(stream.WalkOptions{
+			Include: []string{"*.txt"},
+			Exclude: []string{"node_modules", "sub/deep"},
+		}))
+	})
+
+	t.Run("depth limit", func(t *testing.T) {
+		assert.Equal(t, []string{"a.txt", "b.log", "skip.tmp"}, walk(stream.WalkOptions{MaxDepth: 1}))
+		assert.Equal(t, []string{
+			"a.txt", "b.log", "node_modules/x.txt", "skip.tmp", "sub/c.txt",
+		}, walk(stream.WalkOptions{MaxDepth: 2}))
+	})
+
+	t.Run("directories", func(t *testing.T) {
+		assert.Equal(t, []string{"loop", "node_modules", "sub", "sub/deep"}, walk(stream.WalkOptions{
+			Dirs:    true,
+			Include: []string{"nothing"},
+		}))
+	})
+
+	t.Run("symlinks", func(t *testing.T) {
+		assert.Equal(t, []string{"filelink.txt", "link", "loop/back"}, walk(stream.WalkOptions{
+			Include:  []string{"filelink.txt", "link", "back"},
+			Symlinks: stream.YieldSymlinks,
+		}))
+
+		followed := walk(stream.WalkOptions{Symlinks: stream.FollowSymlinks})
+		assert.Equal(t, []string{
+			"a.txt", "b.log", "filelink.txt", "link/c.txt", "link/deep/d.txt",
+			"node_modules/x.txt", "skip.tmp", "sub/c.txt", "sub/deep/d.txt",
+		}, followed, "the link back to the root is not followed")
+
+		for _, item := range collect(stream.WalkDir(root, stream.WalkOptions{Symlinks: stream.FollowSymlinks, Include: []string{"filelink.txt"}})) {
+			assert.True(t, item.Value.Type().IsRegular())
+		}
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.WalkDir(filepath.Join(root, "missing"), stream.WalkOptions{}),
+			func(_ context.Context, item stream.Item[string, fs.DirEntry]) (stream.Item[string, fs.DirEntry], error) {
+				return item, nil
+			},
+			func(_ context.Context, acc int, _ stream.Item[string, fs.DirEntry]) (int, error) { return acc + 1, nil },
+			0,
+		)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+}
+
+func Test_FileChunks(t *testing.T) {
+	var content bytes.Buffer
+	lines := 0
+	for i := 0; i < 500; i++ {
+		content.WriteString(strings.Repeat("x", i%37))
+		content.WriteByte('\n')
+		lines++
+	}
+	content.WriteString(strings.Repeat("y", 300))
+	content.WriteString("\nno newline at the end")
+	lines += 2
+
+	path := filepath.Join(t.TempDir(), "big.txt")
+	require.NoError(t, os.WriteFile(path, content.Bytes(), 0o644))
+
+	t.Run("chunks end at newlines and cover the file", func(t *testing.T) {
+		chunks := collect(stream.FileChunks(path, 100))
+		require.Greater(t, len(chunks), 10)
+
+		var joined []byte
+		var offset int64
+		for i, chunk := range chunks {
+			assert.Equal(t, i, chunk.Key)
+			assert.Equal(t, offset, chunk.Value.Offset)
+			offset += chunk.Value.Length
+
+			b, err := chunk.Value.Read()
+			require.NoError(t, err)
+			if i < len(chunks)-1 {
+				assert.True(t, bytes.HasSuffix(b, []byte("\n")), "chunk %d", i)
+			}
+			joined = append(joined, b...)
+		}
+		assert.Equal(t, content.Bytes(), joined)
+	})
+
+	t.Run("lines counted in parallel", func(t *testing.T) {
+		counts, err := stream.MapReduce(
+			context.TODO(),
+			stream.FileChunks(path, 64),
+			func(_ context.Context, item stream.Item[int, stream.FileChunk]) (stream.Item[int, int], error) {
+				b, err := item.Value.Read()
+				if err != nil {
+					return stream.Item[int, int]{}, err
+				}
+				n := bytes.Count(b, []byte("\n"))
+				if !bytes.HasSuffix(b, []byte("\n")) {
+					n++
+				}
+				return stream.Item[int, int]{Key: item.Key, Value: n}, nil
+			},
+			func(_ context.Context, acc []int, item stream.Item[int, int]) ([]int, error) {
+				return append(acc, item.Value), nil
+			},
+			nil,
+			stream.WithConcurrency(4),
+		)
+		require.NoError(t, err)
+
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		assert.Equal(t, lines, total)
+	})
+}
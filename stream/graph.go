@@ -0,0 +1,468 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const graphEdgeBuffer = 64
+
+const (
+	sourceStage stageKind = iota
+	mapperStage
+	reducerStage
+	sinkStage
+)
+
+var (
+	ErrDuplicateStage = errors.New("duplicate stage")
+	ErrUnknownStage   = errors.New("unknown stage")
+	ErrDuplicateEdge  = errors.New("duplicate edge")
+	ErrDanglingPort   = errors.New("dangling port")
+	ErrTypeMismatch   = errors.New("type mismatch")
+	ErrCycle          = errors.New("cycle")
+)
+
+type (
+	stageKind uint8
+
+	// stage is a node of the graph, with the types it consumes and produces
+	// erased to reflect.Type, so that they can be checked before running
+	stage struct {
+		name string
+		kind stageKind
+		in   reflect.Type
+		out  reflect.Type
+		run  func(ctx context.Context, ins []<-chan any, outs []chan<- any) error
+	}
+
+	edge struct {
+		from, to string
+	}
+
+	// Graph is a pipeline of named stages connected by typed edges.
+	// Every item a stage produces goes to all the stages it is connected to,
+	// a stage with several inputs consumes the items of all of them.
+	Graph struct {
+		stages map[string]*stage
+		order  []string
+		edges  []edge
+		errs   GraphError
+	}
+
+	// Result holds the value of a reducer stage once the graph has run
+	Result[R any] struct {
+		value R
+	}
+
+	GraphError []error
+)
+
+func (k stageKind) String() string {
+	switch k {
+	case sourceStage:
+		return "source"
+	case mapperStage:
+		return "mapper"
+	case reducerStage:
+		return "reducer"
+	default:
+		return "sink"
+	}
+}
+
+func (gErr GraphError) Error() string {
+	return joinErrors("graph", gErr)
+}
+
+// Is reports whether any of the collected errors matches target
+func (gErr GraphError) Is(target error) bool {
+	return anyErrorIs(gErr, target)
+}
+
+// As finds the first of the collected errors that matches target
+func (gErr GraphError) As(target any) bool {
+	return anyErrorAs(gErr, target)
+}
+
+func (r *Result[R]) Value() R {
+	return r.value
+}
+
+func NewGraph() *Graph {
+	return &Graph{stages: make(map[string]*stage)}
+}
+
+func itemType[K, V any]() reflect.Type {
+	return reflect.TypeOf((*Item[K, V])(nil)).Elem()
+}
+
+func (g *Graph) add(s *stage) {
+	if _, found := g.stages[s.name]; found {
+		g.errs = append(g.errs, fmt.Errorf("%w: %q", ErrDuplicateStage, s.name))
+		return
+	}
+
+	g.stages[s.name] = s
+	g.order = append(g.order, s.name)
+}
+
+// AddSource adds a stage that produces the items of the iterable
+func AddSource[K, V any](g *Graph, name string, iterable Iterable[K, V]) {
+	g.add(&stage{
+		name: name,
+		kind: sourceStage,
+		out:  itemType[K, V](),
+		run: func(ctx context.Context, _ []<-chan any, outs []chan<- any) error {
+			// sources such as Paginate or FileChunks report their errors to
+			// whoever runs them, here that is the stage
+			ctx, hooks := withRunHooks(ctx)
+			inCh := iterable(ctx)
+			defer drain(inCh)
+
+			for item := range inCh {
+				if err := broadcast(ctx, outs, item); err != nil {
+					return err
+				}
+			}
+
+			switch srcErrs := hooks.sourceErrors(); len(srcErrs) {
+			case 0:
+				return nil
+			case 1:
+				return srcErrs[0]
+			default:
+				return GraphError(srcErrs)
+			}
+		},
+	})
+}
+
+// AddMapper adds a stage that maps the items it receives the way MapReduce does
+func AddMapper[K comparable, I, O any](g *Graph, name string, m mapper[K, I, O], options ...reducerOption) {
+	g.add(&stage{
+		name: name,
+		kind: mapperStage,
+		in:   itemType[K, I](),
+		out:  itemType[K, O](),
+		run: func(ctx context.Context, ins []<-chan any, outs []chan<- any) error {
+			return RunInto(ctx, merge[K, I](ins), m, Sink[K, O](&broadcastSink[K, O]{outs: outs}), options...)
+		},
+	})
+}
+
+// AddReducer adds a stage that reduces the items it receives, its result
+// is available once the graph has run
+func AddReducer[K comparable, V, R any](
+	g *Graph,
+	name string,
+	r reducer[K, R, V],
+	initialReducerValue R,
+	options ...reducerOption,
+) *Result[R] {
+	result := &Result[R]{value: initialReducerValue}
+	g.add(&stage{
+		name: name,
+		kind: reducerStage,
+		in:   itemType[K, V](),
+		run: func(ctx context.Context, ins []<-chan any, _ []chan<- any) error {
+			acc, err := MapReduce(ctx, merge[K, V](ins), identity[K, V], r, initialReducerValue, options...)
+			result.value = acc
+			return err
+		},
+	})
+	return result
+}
+
+// AddSink adds a stage that writes the items it receives to the sink
+func AddSink[K comparable, V any](g *Graph, name string, sink Sink[K, V], options ...reducerOption) {
+	g.add(&stage{
+		name: name,
+		kind: sinkStage,
+		in:   itemType[K, V](),
+		run: func(ctx context.Context, ins []<-chan any, _ []chan<- any) error {
+			return RunInto(ctx, merge[K, V](ins), identity[K, V], sink, options...)
+		},
+	})
+}
+
+// Connect sends the items produced by one stage to another,
+// connecting the same stages twice is reported by Validate
+func (g *Graph) Connect(from, to string) *Graph {
+	g.edges = append(g.edges, edge{from: from, to: to})
+	return g
+}
+
+// Validate checks that every edge connects existing stages of matching
+// types once, that every stage is connected the way its kind requires
+// and that there are no cycles
+func (g *Graph) Validate() error {
+	errs := append(GraphError(nil), g.errs...)
+
+	inputs := make(map[string]int)
+	outputs := make(map[string]int)
+	seen := make(map[edge]bool, len(g.edges))
+	for _, e := range g.edges {
+		// a second edge would deliver every item twice
+		if seen[e] {
+			errs = append(errs, fmt.Errorf("%w: %q -> %q", ErrDuplicateEdge, e.from, e.to))
+			continue
+		}
+		seen[e] = true
+
+		from, fromFound := g.stages[e.from]
+		to, toFound := g.stages[e.to]
+		if !fromFound {
+			errs = append(errs, fmt.Errorf("%w: %q in edge %q -> %q", ErrUnknownStage, e.from, e.from, e.to))
+		}
+		if !toFound {
+			errs = append(errs, fmt.Errorf("%w: %q in edge %q -> %q", ErrUnknownStage, e.to, e.from, e.to))
+		}
+		if !fromFound || !toFound {
+			continue
+		}
+
+		switch {
+		case from.out == nil:
+			errs = append(errs, fmt.Errorf("%w: %s %q has no output", ErrDanglingPort, from.kind, e.from))
+		case to.in == nil:
+			errs = append(errs, fmt.Errorf("%w: %s %q has no input", ErrDanglingPort, to.kind, e.to))
+		case from.out != to.in:
+			errs = append(errs, fmt.Errorf(
+				"%w: %q produces %s but %q consumes %s",
+				ErrTypeMismatch, e.from, from.out, e.to, to.in,
+			))
+		}
+
+		outputs[e.from]++
+		inputs[e.to]++
+	}
+
+	for _, name := range g.order {
+		s := g.stages[name]
+		if s.in != nil && inputs[name] == 0 {
+			errs = append(errs, fmt.Errorf("%w: input of %s %q is not connected", ErrDanglingPort, s.kind, name))
+		}
+		if s.out != nil && outputs[name] == 0 {
+			errs = append(errs, fmt.Errorf("%w: output of %s %q is not connected", ErrDanglingPort, s.kind, name))
+		}
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, " -> ")))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// findCycle returns the stages of the first cycle it comes across
+func (g *Graph) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(g.order))
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, e := range g.edges {
+			if e.from != name {
+				continue
+			}
+
+			switch state[e.to] {
+			case visiting:
+				for i := range path {
+					if path[i] == e.to {
+						return append(append([]string(nil), path[i:]...), e.to)
+					}
+				}
+			case unvisited:
+				if _, found := g.stages[e.to]; !found {
+					continue
+				}
+				if cycle := visit(e.to); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range g.order {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// DOT describes the graph in the Graphviz DOT language
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph pipeline {\n")
+	b.WriteString("\trankdir=LR;\n")
+
+	for _, name := range g.order {
+		s := g.stages[name]
+		b.WriteString(fmt.Sprintf(
+			"\t%s [shape=%s, label=%s];\n",
+			strconv.Quote(name), dotShape(s.kind), strconv.Quote(name+"\n"+s.kind.String()),
+		))
+	}
+
+	for _, e := range g.edges {
+		var label string
+		if from, found := g.stages[e.from]; found && from.out != nil {
+			label = fmt.Sprintf(" [label=%s]", strconv.Quote(from.out.String()))
+		}
+		b.WriteString(fmt.Sprintf("\t%s -> %s%s;\n", strconv.Quote(e.from), strconv.Quote(e.to), label))
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotShape(k stageKind) string {
+	switch k {
+	case sourceStage:
+		return "invhouse"
+	case mapperStage:
+		return "box"
+	case reducerStage:
+		return "invtriangle"
+	default:
+		return "house"
+	}
+}
+
+// Run validates the graph and runs all of its stages concurrently.
+// The first stage to fail cancels all the others, Run returns once every
+// stage has stopped, with the errors of all the stages that failed.
+func (g *Graph) Run(ctx context.Context) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ins := make(map[string][]<-chan any)
+	outs := make(map[string][]chan<- any)
+	for _, e := range g.edges {
+		ch := make(chan any, graphEdgeBuffer)
+		outs[e.from] = append(outs[e.from], ch)
+		ins[e.to] = append(ins[e.to], ch)
+	}
+
+	var mux sync.Mutex
+	var errs GraphError
+	var stages sync.WaitGroup
+
+	for _, name := range g.order {
+		stages.Add(1)
+		go func(s *stage) {
+			defer stages.Done()
+			defer func() {
+				for _, ch := range outs[s.name] {
+					close(ch)
+				}
+			}()
+
+			err := s.run(ctx, ins[s.name], outs[s.name])
+			if err == nil || (errors.Is(err, context.Canceled) && ctx.Err() != nil) {
+				return
+			}
+
+			mux.Lock()
+			errs = append(errs, fmt.Errorf("stage %q: %w", s.name, err))
+			mux.Unlock()
+			cancel()
+		}(g.stages[name])
+	}
+
+	stages.Wait()
+	if len(errs) == 0 {
+		return ctx.Err()
+	}
+
+	return errs
+}
+
+type broadcastSink[K, V any] struct {
+	outs []chan<- any
+}
+
+func (s *broadcastSink[K, V]) Write(ctx context.Context, item Item[K, V]) error {
+	return broadcast(ctx, s.outs, item)
+}
+
+// Close leaves the channels to the graph, which closes them once the stage is over
+func (s *broadcastSink[K, V]) Close() error {
+	return nil
+}
+
+func broadcast[K, V any](ctx context.Context, outs []chan<- any, item Item[K, V]) error {
+	for _, out := range outs {
+		select {
+		case out <- item:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// merge turns the inputs of a stage into an Iterable of the type the stage consumes
+func merge[K, V any](ins []<-chan any) Iterable[K, V] {
+	return func(ctx context.Context) <-chan Item[K, V] {
+		resultCh := make(chan Item[K, V])
+		var forwarders sync.WaitGroup
+
+		for _, in := range ins {
+			forwarders.Add(1)
+			go func(in <-chan any) {
+				defer forwarders.Done()
+				for v := range in {
+					select {
+					case resultCh <- v.(Item[K, V]):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(in)
+		}
+
+		go func() {
+			forwarders.Wait()
+			close(resultCh)
+		}()
+
+		return resultCh
+	}
+}
+
+func identity[K comparable, V any](_ context.Context, item Item[K, V]) (Item[K, V], error) {
+	return item, nil
+}
@@ -0,0 +1,193 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Graph(t *testing.T) {
+	type intItem = stream.Item[int, int]
+	type strItem = stream.Item[int, string]
+
+	double := func(_ context.Context, item intItem) (intItem, error) {
+		return intItem{Key: item.Key, Value: item.Value * 2}, nil
+	}
+
+	negate := func(_ context.Context, item intItem) (intItem, error) {
+		return intItem{Key: item.Key, Value: -item.Value}, nil
+	}
+
+	format := func(_ context.Context, item intItem) (strItem, error) {
+		return strItem{Key: item.Key, Value: fmt.Sprintf("#%d", item.Value)}, nil
+	}
+
+	sum := func(_ context.Context, acc int, item intItem) (int, error) {
+		return acc + item.Value, nil
+	}
+
+	t.Run("fan out and fan in", func(t *testing.T) {
+		g := stream.NewGraph()
+		stream.AddSource(g, "numbers", stream.Slice([]int{1, 2, 3, 4}))
+		stream.AddMapper(g, "double", double, stream.WithConcurrency(2))
+		stream.AddMapper(g, "negate", negate)
+		stream.AddMapper(g, "format", format)
+		total := stream.AddReducer(g, "sum", sum, 0)
+
+		ch := make(chan strItem, 100)
+		stream.AddSink(g, "out", stream.ChanSink(ch))
+
+		g.Connect("numbers", "double").
+			Connect("numbers", "negate").
+			Connect("double", "sum").
+			Connect("negate", "sum").
+			Connect("double", "format").
+			Connect("format", "out")
+
+		require.NoError(t, g.Validate())
+		require.NoError(t, g.Run(context.TODO()))
+
+		assert.Equal(t, 10, total.Value())
+
+		var formatted []string
+		for item := range ch {
+			formatted = append(formatted, item.Value)
+		}
+		sort.Strings(formatted)
+		assert.Equal(t, []string{"#2", "#4", "#6", "#8"}, formatted)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		g := stream.NewGraph()
+		stream.AddSource(g, "numbers", stream.Slice([]int{1, 2, 3}))
+		stream.AddSource(g, "numbers", stream.Slice([]int{4}))
+		stream.AddSource(g, "unused", stream.Slice([]int{5}))
+		stream.AddMapper(g, "double", double)
+		stream.AddMapper(g, "negate", negate)
+		stream.AddMapper(g, "format", format)
+		stream.AddReducer(g, "sum", sum, 0)
+
+		g.Connect("numbers", "double").
+			Connect("numbers", "double").
+			Connect("double", "negate").
+			Connect("negate", "double").
+			Connect("format", "sum").
+			Connect("sum", "double").
+			Connect("numbers", "nowhere")
+
+		err := g.Validate()
+		require.Error(t, err)
+
+		for _, target := range []error{
+			stream.ErrDuplicateStage,
+			stream.ErrUnknownStage,
+			stream.ErrDuplicateEdge,
+			stream.ErrDanglingPort,
+			stream.ErrTypeMismatch,
+			stream.ErrCycle,
+		} {
+			assert.True(t, errors.Is(err, target), "expected %v in %v", target, err)
+		}
+
+		msg := err.Error()
+		assert.Contains(t, msg, `duplicate stage: "numbers"`)
+		assert.Contains(t, msg, `unknown stage: "nowhere"`)
+		assert.Contains(t, msg, `duplicate edge: "numbers" -> "double"`)
+		assert.Contains(t, msg, `output of source "unused" is not connected`)
+		assert.Contains(t, msg, `input of mapper "format" is not connected`)
+		assert.Contains(t, msg, `reducer "sum" has no output`)
+		assert.Contains(t, msg, "cycle: double -> negate -> double")
+		assert.Contains(t, msg, `"format" produces superstream.Item[int,string] but "sum" consumes superstream.Item[int,int]`)
+
+		assert.Equal(t, err, g.Run(context.TODO()))
+	})
+
+	t.Run("dot export", func(t *testing.T) {
+		g := stream.NewGraph()
+		stream.AddSource(g, "numbers", stream.Slice([]int{1}))
+		stream.AddMapper(g, "format", format)
+		stream.AddSink(g, "out", stream.ChanSink(make(chan strItem, 1)))
+		g.Connect("numbers", "format").Connect("format", "out")
+
+		expected := strings.Join([]string{
+			"digraph pipeline {",
+			"\trankdir=LR;",
+			`	"numbers" [shape=invhouse, label="numbers\nsource"];`,
+			`	"format" [shape=box, label="format\nmapper"];`,
+			`	"out" [shape=house, label="out\nsink"];`,
+			`	"numbers" -> "format" [label="superstream.Item[int,int]"];`,
+			`	"format" -> "out" [label="superstream.Item[int,string]"];`,
+			"}",
+			"",
+		}, "\n")
+		assert.Equal(t, expected, g.DOT())
+	})
+
+	t.Run("a failing stage stops the others and errors are collected", func(t *testing.T) {
+		in := make([]int, 10_000)
+		for i := range in {
+			in[i] = i
+		}
+
+		failing := func(_ context.Context, item intItem) (intItem, error) {
+			if item.Value == 100 {
+				return item, errors.New("bad item")
+			}
+			return item, nil
+		}
+
+		assertNoLeaks(t, func() {
+			g := stream.NewGraph()
+			stream.AddSource(g, "numbers", stream.Slice(in))
+			stream.AddMapper(g, "failing", failing, stream.WithConcurrency(4))
+			stream.AddMapper(g, "double", double)
+			total := stream.AddReducer(g, "sum", sum, 0)
+			stream.AddSink(g, "out", stream.ChanSink(make(chan intItem)))
+
+			g.Connect("numbers", "failing").
+				Connect("numbers", "double").
+				Connect("failing", "sum").
+				Connect("double", "out")
+
+			err := g.Run(context.TODO())
+			require.Error(t, err)
+
+			var gErr stream.GraphError
+			require.True(t, errors.As(err, &gErr))
+			require.Len(t, gErr, 1)
+			assert.Contains(t, err.Error(), `stage "failing": 1 map reduce errors: map error: bad item`)
+			assert.True(t, total.Value() < 10_000*9_999/2)
+		})
+	})
+
+	t.Run("source errors fail the source stage", func(t *testing.T) {
+		type pageItem = stream.Item[stream.PagePosition, int]
+
+		fetch := func(_ context.Context, cursor stream.Cursor) ([]int, stream.Cursor, error) {
+			if cursor == "" {
+				return []int{1, 2, 3}, "next", nil
+			}
+			return nil, "", errors.New("service unavailable")
+		}
+
+		assertNoLeaks(t, func() {
+			g := stream.NewGraph()
+			stream.AddSource(g, "pages", stream.Paginate(fetch, stream.PaginateOptions{}))
+			stream.AddReducer(g, "sum", func(_ context.Context, acc int, item pageItem) (int, error) {
+				return acc + item.Value, nil
+			}, 0)
+			g.Connect("pages", "sum")
+
+			err := g.Run(context.TODO())
+			require.Error(t, err)
+			assert.EqualError(t, err, `1 graph errors: stage "pages": paginate error at cursor "next": service unavailable`)
+		})
+	})
+}
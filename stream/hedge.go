@@ -0,0 +1,98 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type hedging struct {
+	after    time.Duration
+	maxExtra int
+}
+
+// WithHedging starts a duplicate mapper call for an item whose call has not
+// finished within after, and another one after every further after, up to
+// maxExtra duplicates per item. The first call to succeed wins and the context
+// of the others is cancelled, which the mapper should respect. A failed call
+// does not wait for the others, the error of the first call to fail is returned
+// once none is left running. Mappers have to be safe to call more than once
+// for the same item. Stats count the duplicates started and the ones that won.
+func WithHedging(after time.Duration, maxExtra int) reducerOption {
+	return func(fc *flowControl) {
+		if after > 0 && maxExtra > 0 {
+			fc.hedging = &hedging{after: after, maxExtra: maxExtra}
+		}
+	}
+}
+
+// hedgedMapper runs every call of m in a goroutine of its own, tracked by
+// tasks, so that a straggler can be raced against its duplicates
+func hedgedMapper[K comparable, I, O any](fc *flowControl, tasks *sync.WaitGroup, m mapper[K, I, O]) mapper[K, I, O] {
+	if fc.hedging == nil {
+		return m
+	}
+
+	type attempt struct {
+		result Item[K, O]
+		err    error
+		hedge  bool
+	}
+
+	after, maxExtra := fc.hedging.after, fc.hedging.maxExtra
+	return func(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// buffered for every attempt, so that the losers never block
+		doneCh := make(chan attempt, maxExtra+1)
+		launch := func(hedge bool) {
+			tasks.Add(1)
+			go func() {
+				defer tasks.Done()
+				result, err := safeMap(ctx, m, item)
+				doneCh <- attempt{result: result, err: err, hedge: hedge}
+			}()
+		}
+
+		launch(false)
+		running, extra := 1, 0
+
+		timer := time.NewTimer(after)
+		defer timer.Stop()
+
+		var firstErr error
+		for {
+			select {
+			case a := <-doneCh:
+				running--
+				if a.err == nil || errors.Is(a.err, ErrSkip) {
+					if a.hedge && a.err == nil {
+						atomic.AddInt64(&fc.stats.HedgeWins, 1)
+					}
+					return a.result, a.err
+				}
+
+				if firstErr == nil {
+					firstErr = a.err
+				}
+
+				if running == 0 {
+					return Zero[Item[K, O]](), firstErr
+				}
+			case <-timer.C:
+				if extra < maxExtra {
+					launch(true)
+					extra++
+					running++
+					atomic.AddInt64(&fc.stats.Hedged, 1)
+					timer.Reset(after)
+				}
+			case <-ctx.Done():
+				return Zero[Item[K, O]](), ctx.Err()
+			}
+		}
+	}
+}
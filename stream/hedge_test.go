@@ -0,0 +1,100 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Hedging(t *testing.T) {
+	type intItem = stream.Item[int, int]
+
+	sum := func(_ context.Context, acc int, item intItem) (int, error) { return acc + item.Value, nil }
+
+	t.Run("duplicates win over stragglers", func(t *testing.T) {
+		var mux sync.Mutex
+		calls := make(map[int]int)
+		var cancelled int64
+
+		// the first call for every third item hangs until it is cancelled
+		mapper := func(ctx context.Context, item intItem) (intItem, error) {
+			mux.Lock()
+			calls[item.Key]++
+			first := calls[item.Key] == 1
+			mux.Unlock()
+
+			if first && item.Key%3 == 0 {
+				<-ctx.Done()
+				atomic.AddInt64(&cancelled, 1)
+				return intItem{}, ctx.Err()
+			}
+			return item, nil
+		}
+
+		var log progressLog
+		assertNoLeaks(t, func() {
+			result, err := stream.MapReduce(
+				context.TODO(),
+				stream.Slice([]int{1, 2, 3, 4, 5, 6, 7, 8, 9}),
+				mapper,
+				sum,
+				0,
+				stream.WithConcurrency(3),
+				stream.WithHedging(5*time.Millisecond, 2),
+				stream.WithProgress(log.report),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, 45, result)
+		})
+
+		stats := log.last().Stats
+		assert.Equal(t, int64(3), stats.Hedged)
+		assert.Equal(t, int64(3), stats.HedgeWins)
+		assert.Equal(t, int64(3), atomic.LoadInt64(&cancelled))
+	})
+
+	t.Run("fast calls are not hedged", func(t *testing.T) {
+		var log progressLog
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3}),
+			func(_ context.Context, item intItem) (intItem, error) { return item, nil },
+			sum,
+			0,
+			stream.WithHedging(time.Second, 1),
+			stream.WithProgress(log.report),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, stream.Stats{Processed: 3}, log.last().Stats)
+	})
+
+	t.Run("error once every call failed", func(t *testing.T) {
+		errSlow := errors.New("slow failure")
+		var calls int64
+
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1}),
+			func(_ context.Context, item intItem) (intItem, error) {
+				if atomic.AddInt64(&calls, 1) == 1 {
+					time.Sleep(20 * time.Millisecond)
+					return intItem{}, errSlow
+				}
+				return intItem{}, errors.New("fast failure")
+			},
+			sum,
+			0,
+			stream.WithHedging(5*time.Millisecond, 1),
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "fast failure")
+		assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+	})
+}
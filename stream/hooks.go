@@ -0,0 +1,171 @@
+package superstream
+
+import (
+	"context"
+	"sync"
+)
+
+type runHooksKey struct{}
+
+// runHooks lets the built-in sources offer MapReduce a faster way to consume
+// them than reading one item at a time. Offers are keyed by the channel the
+// Iterable returned, so a source that is wrapped by another Iterable is never
+// short-circuited: MapReduce only ever asks about the channel it was handed.
+type runHooks struct {
+	mux    sync.Mutex
+	offers map[any]any
+	sizes  map[any]int64
+	errs   []error
+}
+
+func withRunHooks(ctx context.Context) (context.Context, *runHooks) {
+	h := &runHooks{offers: make(map[any]any), sizes: make(map[any]int64)}
+	return context.WithValue(ctx, runHooksKey{}, h), h
+}
+
+func runHooksFrom(ctx context.Context) *runHooks {
+	h, _ := ctx.Value(runHooksKey{}).(*runHooks)
+	return h
+}
+
+func (h *runHooks) offer(ch, o any) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.offers[ch] = o
+}
+
+func (h *runHooks) lookup(ch any) (any, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	o, ok := h.offers[ch]
+	return o, ok
+}
+
+func (h *runHooks) size(ch any) (int64, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	n, ok := h.sizes[ch]
+	return n, ok
+}
+
+// reportSourceError hands an error that a source has no other way to surface
+// to the running MapReduce or graph source stage, if any, which returns it
+// along with its own errors
+func reportSourceError(ctx context.Context, err error) {
+	h := runHooksFrom(ctx)
+	if h == nil {
+		return
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.errs = append(h.errs, err)
+}
+
+func (h *runHooks) sourceErrors() []error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return append([]error(nil), h.errs...)
+}
+
+// hintSize tells the running MapReduce, if any, how many items ch is going to yield
+func hintSize[K, V any](ctx context.Context, ch <-chan Item[K, V], n int) {
+	h := runHooksFrom(ctx)
+	if h == nil {
+		return
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.sizes[ch] = int64(n)
+}
+
+// chunkClaim is what MapReduce sends to a source that offered the chunked transport.
+type chunkClaim[K, V any] struct {
+	chunkCh chan<- []Item[K, V]
+	size    int
+}
+
+// offerChunks registers resultCh as able to deliver chunks directly. The returned
+// channel receives a claim if the running MapReduce decides to take the offer
+// and is nil when the Iterable is not consumed by MapReduce at all.
+func offerChunks[K, V any](ctx context.Context, resultCh chan Item[K, V]) <-chan chunkClaim[K, V] {
+	h := runHooksFrom(ctx)
+	if h == nil {
+		return nil
+	}
+
+	claimCh := make(chan chunkClaim[K, V], 1)
+	h.offer((<-chan Item[K, V])(resultCh), claimCh)
+	return claimCh
+}
+
+// claimChunks takes the chunked transport offer made for inCh if there is one.
+func claimChunks[K, V any](ctx context.Context, inCh <-chan Item[K, V], claim chunkClaim[K, V]) bool {
+	h := runHooksFrom(ctx)
+	if h == nil {
+		return false
+	}
+
+	o, ok := h.lookup(inCh)
+	if !ok {
+		return false
+	}
+
+	claimCh, ok := o.(chan chunkClaim[K, V])
+	if !ok {
+		return false
+	}
+
+	claimCh <- claim
+	return true
+}
+
+// pump sends the items produced by walk one by one to resultCh or, once
+// the consumer claims the chunked transport, in chunks straight to it.
+func pump[K, V any](
+	ctx context.Context,
+	resultCh chan<- Item[K, V],
+	claimCh <-chan chunkClaim[K, V],
+	walk func(yield func(Item[K, V]) bool),
+) {
+	var claim chunkClaim[K, V]
+	var chunk []Item[K, V]
+
+	flush := func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case claim.chunkCh <- chunk:
+			chunk = nil
+			return true
+		}
+	}
+
+	walk(func(item Item[K, V]) bool {
+		if claim.chunkCh == nil {
+			select {
+			case <-ctx.Done():
+				return false
+			case claim = <-claimCh:
+			case resultCh <- item:
+				return true
+			}
+		}
+
+		if chunk == nil {
+			chunk = make([]Item[K, V], 0, claim.size)
+		}
+
+		chunk = append(chunk, item)
+		if len(chunk) < claim.size {
+			return true
+		}
+
+		return flush()
+	})
+
+	if len(chunk) > 0 {
+		flush()
+	}
+}
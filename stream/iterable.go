@@ -9,20 +9,24 @@ type Item[K any, V any] struct {
 	Value V
 }
 
+// Iterable is a source of items. It must close the channel it returns once
+// it runs out of items or ctx is done, whichever happens first.
 type Iterable[K, V any] func(ctx context.Context) <-chan Item[K, V]
 
 func Slice[V any](items []V) Iterable[int, V] {
 	return func(ctx context.Context) <-chan Item[int, V] {
 		resultCh := make(chan Item[int, V])
+		hintSize[int, V](ctx, resultCh, len(items))
+		claimCh := offerChunks(ctx, resultCh)
 		go func() {
 			defer close(resultCh)
-			for i := 0; i < len(items); i++ {
-				select {
-				case <-ctx.Done():
-					return
-				case resultCh <- Item[int, V]{Key: i, Value: items[i]}:
+			pump(ctx, resultCh, claimCh, func(yield func(Item[int, V]) bool) {
+				for i := 0; i < len(items); i++ {
+					if !yield(Item[int, V]{Key: i, Value: items[i]}) {
+						return
+					}
 				}
-			}
+			})
 		}()
 		return resultCh
 	}
@@ -31,20 +35,32 @@ func Slice[V any](items []V) Iterable[int, V] {
 func Map[K comparable, V any](m map[K]V) Iterable[K, V] {
 	return func(ctx context.Context) <-chan Item[K, V] {
 		resultCh := make(chan Item[K, V])
+		hintSize[K, V](ctx, resultCh, len(m))
+		claimCh := offerChunks(ctx, resultCh)
 		go func() {
 			defer close(resultCh)
-			for k, v := range m {
-				select {
-				case <-ctx.Done():
-					return
-				case resultCh <- Item[K, V]{Key: k, Value: v}:
+			pump(ctx, resultCh, claimCh, func(yield func(Item[K, V]) bool) {
+				for k, v := range m {
+					if !yield(Item[K, V]{Key: k, Value: v}) {
+						return
+					}
 				}
-			}
+			})
 		}()
 		return resultCh
 	}
 }
 
+// Sized tells MapReduce how many items the iterable is going to yield,
+// which makes it possible to report the progress of a run against a total.
+func Sized[K, V any](iterable Iterable[K, V], n int) Iterable[K, V] {
+	return func(ctx context.Context) <-chan Item[K, V] {
+		resultCh := iterable(ctx)
+		hintSize(ctx, resultCh, n)
+		return resultCh
+	}
+}
+
 func Zero[T any]() T {
 	var zero T
 	return zero
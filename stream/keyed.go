@@ -0,0 +1,383 @@
+package superstream
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// State is the state KeyedProcess keeps for the key being processed
+	State[S any] interface {
+		// Get returns the state of the key, false when there is none
+		Get() (S, bool)
+		// Update replaces the state of the key, which restarts its TTL
+		Update(s S)
+		// Clear forgets the state of the key
+		Clear()
+		// SetTimer asks for OnTimer to be called for the key at the given time,
+		// replacing the timer set before, if any
+		SetTimer(at time.Time)
+		// ClearTimer cancels the timer of the key
+		ClearTimer()
+	}
+
+	// KeyedSnapshot is the state of all the keys after Processed items
+	KeyedSnapshot[K comparable, S any] struct {
+		Processed int64
+		State     map[K]S
+	}
+
+	// StateStore keeps the snapshots of a KeyedProcess, so that it can
+	// pick up where it left off
+	StateStore[K comparable, S any] interface {
+		// Load returns the latest snapshot, an empty one when there is none
+		Load(ctx context.Context) (KeyedSnapshot[K, S], error)
+		Save(ctx context.Context, snapshot KeyedSnapshot[K, S]) error
+	}
+
+	// Keyed tells KeyedProcess what to do with the items and the state of every key
+	Keyed[K comparable, V, S, O any] struct {
+		// Process is called for every item with the state of its key
+		Process func(ctx context.Context, item Item[K, V], state State[S], emit func(Item[K, O])) error
+		// OnTimer is called when a timer set for a key is due, nil if no timers are set
+		OnTimer func(ctx context.Context, key K, at time.Time, state State[S], emit func(Item[K, O])) error
+		// TTL forgets the state of a key that has not been updated for that long, zero keeps it forever
+		TTL time.Duration
+		// Clock drives TTLs and timers, nil for SystemClock
+		Clock Clock
+		// Store, if any, restores the state when the stream starts and saves it
+		// every SnapshotEvery items, if positive, and when the source is exhausted.
+		// The iterable is expected to replay from the start, the items a restored
+		// snapshot already covers are skipped rather than processed again.
+		Store         StateStore[K, S]
+		SnapshotEvery int
+	}
+
+	fileStateStore[K comparable, S any] struct {
+		path  string
+		codec Codec[KeyedSnapshot[K, S]]
+	}
+
+	stateEntry[S any] struct {
+		value   S
+		expires time.Time
+	}
+
+	// deadline is when the state of key expires or, for a timer, when it is due
+	deadline[K any] struct {
+		at    time.Time
+		key   K
+		timer bool
+	}
+
+	deadlineHeap[K any] []deadline[K]
+
+	keyedStates[K comparable, S any] struct {
+		clock     Clock
+		ttl       time.Duration
+		entries   map[K]*stateEntry[S]
+		timers    map[K]time.Time
+		deadlines deadlineHeap[K]
+	}
+
+	keyedState[K comparable, S any] struct {
+		states *keyedStates[K, S]
+		key    K
+	}
+)
+
+// KeyedProcess runs the callbacks of k for the items of the iterable, one at
+// a time, handing them the state of the key of the item, so that stateful
+// processing needs no locks. Items emitted by the callbacks make up the
+// resulting stream. A callback error ends the stream and the running MapReduce
+// gets it, as does a failure to load or save the state. Timers are not part
+// of the snapshots.
+func KeyedProcess[K comparable, V, S, O any](iterable Iterable[K, V], k Keyed[K, V, S, O]) Iterable[K, O] {
+	clock := k.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, O]) bool) {
+		states := &keyedStates[K, S]{
+			clock:   clock,
+			ttl:     k.TTL,
+			entries: make(map[K]*stateEntry[S]),
+			timers:  make(map[K]time.Time),
+		}
+
+		var processed, skip int64
+		if k.Store != nil {
+			snapshot, err := k.Store.Load(ctx)
+			if err != nil {
+				reportSourceError(ctx, fmt.Errorf("state load error: %w", err))
+				return
+			}
+
+			processed, skip = snapshot.Processed, snapshot.Processed
+			for key, s := range snapshot.State {
+				states.update(key, s)
+			}
+		}
+
+		save := func() bool {
+			if err := k.Store.Save(ctx, states.snapshot(processed)); err != nil {
+				reportSourceError(ctx, fmt.Errorf("state save error: %w", err))
+				return false
+			}
+			return true
+		}
+
+		stopped := false
+		out := func(item Item[K, O]) {
+			if !stopped && !emit(item) {
+				stopped = true
+			}
+		}
+
+		fire := func() bool {
+			for _, d := range states.due() {
+				if k.OnTimer == nil {
+					continue
+				}
+
+				state := &keyedState[K, S]{states: states, key: d.key}
+				if err := k.OnTimer(ctx, d.key, d.at, state, out); err != nil {
+					reportSourceError(ctx, fmt.Errorf("keyed timer error: %w", err))
+					return false
+				}
+			}
+			return true
+		}
+
+		var timer Timer
+		var timerCh <-chan time.Time
+		var armed time.Time
+		defer func() { stopTimer(timer) }()
+
+		for !stopped {
+			// the clock timer always follows the earliest deadline
+			next, ok := states.next()
+			switch {
+			case !ok:
+				stopTimer(timer)
+				timer, timerCh = nil, nil
+			case !next.After(clock.Now()):
+				if !fire() {
+					return
+				}
+				continue
+			case timer == nil || !next.Equal(armed):
+				stopTimer(timer)
+				timer = clock.NewTimer(next.Sub(clock.Now()))
+				timerCh, armed = timer.C(), next
+			}
+
+			select {
+			case item, ok := <-inCh:
+				if !ok {
+					if k.Store != nil && ctx.Err() == nil {
+						save()
+					}
+					return
+				}
+
+				if skip > 0 {
+					skip--
+					continue
+				}
+
+				if err := k.Process(ctx, item, &keyedState[K, S]{states: states, key: item.Key}, out); err != nil {
+					reportSourceError(ctx, fmt.Errorf("keyed process error: %w", err))
+					return
+				}
+
+				processed++
+				if k.Store != nil && k.SnapshotEvery > 0 && processed%int64(k.SnapshotEvery) == 0 && !save() {
+					return
+				}
+			case <-timerCh:
+				timer, timerCh = nil, nil
+				if !fire() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// FileStateStore keeps the latest snapshot in the file at path. A snapshot
+// is written to a temporary file first and renamed over the previous one,
+// so a crash while saving leaves the previous snapshot intact.
+func FileStateStore[K comparable, S any](path string, codec Codec[KeyedSnapshot[K, S]]) StateStore[K, S] {
+	return &fileStateStore[K, S]{path: path, codec: codec}
+}
+
+func (s *fileStateStore[K, S]) Load(_ context.Context) (KeyedSnapshot[K, S], error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return KeyedSnapshot[K, S]{}, nil
+	}
+
+	if err != nil {
+		return KeyedSnapshot[K, S]{}, err
+	}
+	defer f.Close()
+
+	return s.codec.NewDecoder(f).Decode()
+}
+
+func (s *fileStateStore[K, S]) Save(_ context.Context, snapshot KeyedSnapshot[K, S]) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.codec.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (ks *keyedStates[K, S]) get(key K) (S, bool) {
+	e, ok := ks.entries[key]
+	if !ok || ks.expired(e) {
+		return Zero[S](), false
+	}
+
+	return e.value, true
+}
+
+func (ks *keyedStates[K, S]) update(key K, s S) {
+	e := &stateEntry[S]{value: s}
+	if ks.ttl > 0 {
+		e.expires = ks.clock.Now().Add(ks.ttl)
+		heap.Push(&ks.deadlines, deadline[K]{at: e.expires, key: key})
+	}
+
+	ks.entries[key] = e
+}
+
+func (ks *keyedStates[K, S]) setTimer(key K, at time.Time) {
+	ks.timers[key] = at
+	heap.Push(&ks.deadlines, deadline[K]{at: at, key: key, timer: true})
+}
+
+func (ks *keyedStates[K, S]) expired(e *stateEntry[S]) bool {
+	return ks.ttl > 0 && !e.expires.After(ks.clock.Now())
+}
+
+// valid tells whether d still stands, deadlines are not removed from the
+// heap when a state is updated or a timer is replaced, they are skipped
+func (ks *keyedStates[K, S]) valid(d deadline[K]) bool {
+	if d.timer {
+		at, ok := ks.timers[d.key]
+		return ok && at.Equal(d.at)
+	}
+
+	e, ok := ks.entries[d.key]
+	return ok && e.expires.Equal(d.at)
+}
+
+// next returns the earliest deadline that still stands
+func (ks *keyedStates[K, S]) next() (time.Time, bool) {
+	for len(ks.deadlines) > 0 {
+		if d := ks.deadlines[0]; ks.valid(d) {
+			return d.at, true
+		}
+		heap.Pop(&ks.deadlines)
+	}
+
+	return time.Time{}, false
+}
+
+// due expires the states that are due and returns the timers that are, earliest first
+func (ks *keyedStates[K, S]) due() []deadline[K] {
+	now := ks.clock.Now()
+
+	var timers []deadline[K]
+	for len(ks.deadlines) > 0 && !ks.deadlines[0].at.After(now) {
+		d := heap.Pop(&ks.deadlines).(deadline[K])
+		if !ks.valid(d) {
+			continue
+		}
+
+		if d.timer {
+			delete(ks.timers, d.key)
+			timers = append(timers, d)
+		} else {
+			delete(ks.entries, d.key)
+		}
+	}
+
+	return timers
+}
+
+func (ks *keyedStates[K, S]) snapshot(processed int64) KeyedSnapshot[K, S] {
+	snapshot := KeyedSnapshot[K, S]{Processed: processed, State: make(map[K]S, len(ks.entries))}
+	for key, e := range ks.entries {
+		if !ks.expired(e) {
+			snapshot.State[key] = e.value
+		}
+	}
+
+	return snapshot
+}
+
+func (s *keyedState[K, S]) Get() (S, bool) {
+	return s.states.get(s.key)
+}
+
+func (s *keyedState[K, S]) Update(v S) {
+	s.states.update(s.key, v)
+}
+
+func (s *keyedState[K, S]) Clear() {
+	delete(s.states.entries, s.key)
+}
+
+func (s *keyedState[K, S]) SetTimer(at time.Time) {
+	s.states.setTimer(s.key, at)
+}
+
+func (s *keyedState[K, S]) ClearTimer() {
+	delete(s.states.timers, s.key)
+}
+
+func (h deadlineHeap[K]) Len() int {
+	return len(h)
+}
+
+func (h deadlineHeap[K]) Less(i, j int) bool {
+	return h[i].at.Before(h[j].at)
+}
+
+func (h deadlineHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *deadlineHeap[K]) Push(x any) {
+	*h = append(*h, x.(deadline[K]))
+}
+
+func (h *deadlineHeap[K]) Pop() any {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return d
+}
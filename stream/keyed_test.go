@@ -0,0 +1,155 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_KeyedProcess(t *testing.T) {
+	type purchase = stream.Item[string, int]
+
+	start := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	purchases := func(in ...purchase) stream.Iterable[string, int] {
+		return func(ctx context.Context) <-chan purchase {
+			resultCh := make(chan purchase)
+			go func() {
+				defer close(resultCh)
+				for _, p := range in {
+					select {
+					case resultCh <- p:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return resultCh
+		}
+	}
+
+	runningTotal := func(_ context.Context, item purchase, state stream.State[int], emit func(purchase)) error {
+		total, _ := state.Get()
+		total += item.Value
+		state.Update(total)
+		emit(purchase{Key: item.Key, Value: total})
+		return nil
+	}
+
+	t.Run("running totals per key", func(t *testing.T) {
+		totals := collect(stream.KeyedProcess(
+			purchases(purchase{"ann", 5}, purchase{"bob", 1}, purchase{"ann", 2}, purchase{"bob", 10}),
+			stream.Keyed[string, int, int, int]{Process: runningTotal},
+		))
+
+		assert.Equal(t, []purchase{{"ann", 5}, {"bob", 1}, {"ann", 7}, {"bob", 11}}, totals)
+	})
+
+	t.Run("state expires after its TTL", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+		dedup := func(_ context.Context, item timedItem, state stream.State[bool], emit func(timedItem)) error {
+			if _, seen := state.Get(); !seen {
+				state.Update(true)
+				emit(item)
+			}
+			return nil
+		}
+
+		out := stream.KeyedProcess(manualSource(src), stream.Keyed[int, string, bool, string]{
+			Process: dedup,
+			TTL:     10 * time.Millisecond,
+			Clock:   clock,
+		})(context.Background())
+
+		src <- timedItem{Key: 1, Value: "a"}
+		assert.Equal(t, "a", receive(t, out).Value)
+		src <- timedItem{Key: 1, Value: "b"}
+		src <- timedItem{Key: 2, Value: "c"}
+		assert.Equal(t, "c", receive(t, out).Value)
+
+		clock.BlockUntilTimers(1)
+		clock.Advance(10 * time.Millisecond)
+
+		src <- timedItem{Key: 1, Value: "d"}
+		assert.Equal(t, "d", receive(t, out).Value)
+		close(src)
+		assertClosed(t, out)
+	})
+
+	t.Run("timers", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+
+		// a session of a key ends 10ms after its last item
+		out := stream.KeyedProcess(manualSource(src), stream.Keyed[int, string, []string, []string]{
+			Process: func(_ context.Context, item timedItem, state stream.State[[]string], _ func(stream.Item[int, []string])) error {
+				session, _ := state.Get()
+				state.Update(append(session, item.Value))
+				state.SetTimer(clock.Now().Add(10 * time.Millisecond))
+				return nil
+			},
+			OnTimer: func(_ context.Context, key int, _ time.Time, state stream.State[[]string], emit func(stream.Item[int, []string])) error {
+				session, _ := state.Get()
+				state.Clear()
+				emit(stream.Item[int, []string]{Key: key, Value: session})
+				return nil
+			},
+			Clock: clock,
+		})(context.Background())
+
+		src <- timedItem{Key: 1, Value: "a"}
+		clock.BlockUntilTimers(1)
+		clock.Advance(5 * time.Millisecond)
+		src <- timedItem{Key: 1, Value: "b"}
+		clock.BlockUntilTimers(2)
+		clock.Advance(10 * time.Millisecond)
+
+		assert.Equal(t, stream.Item[int, []string]{Key: 1, Value: []string{"a", "b"}}, receive(t, out))
+		close(src)
+		assertClosed(t, out)
+	})
+
+	t.Run("state is restored from snapshots", func(t *testing.T) {
+		store := stream.FileStateStore(
+			filepath.Join(t.TempDir(), "totals.json"),
+			stream.JSONCodec[stream.KeyedSnapshot[string, int]](),
+		)
+		keyed := stream.Keyed[string, int, int, int]{Process: runningTotal, Store: store, SnapshotEvery: 2}
+
+		bought := []purchase{{"ann", 5}, {"bob", 1}, {"ann", 2}}
+		collect(stream.KeyedProcess(purchases(bought...), keyed))
+
+		snapshot, err := store.Load(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, stream.KeyedSnapshot[string, int]{Processed: 3, State: map[string]int{"ann": 7, "bob": 1}}, snapshot)
+
+		// the source replays from the start, the items in the snapshot are skipped
+		totals := collect(stream.KeyedProcess(purchases(append(bought, purchase{"bob", 4})...), keyed))
+		assert.Equal(t, []purchase{{"bob", 5}}, totals)
+
+		snapshot, err = store.Load(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, stream.KeyedSnapshot[string, int]{Processed: 4, State: map[string]int{"ann": 7, "bob": 5}}, snapshot)
+	})
+
+	t.Run("errors reach MapReduce", func(t *testing.T) {
+		errBroke := errors.New("broke")
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.KeyedProcess(purchases(purchase{"ann", 5}), stream.Keyed[string, int, int, int]{
+				Process: func(context.Context, purchase, stream.State[int], func(purchase)) error { return errBroke },
+			}),
+			func(_ context.Context, item purchase) (purchase, error) { return item, nil },
+			func(_ context.Context, acc int, _ purchase) (int, error) { return acc + 1, nil },
+			0,
+		)
+		assert.True(t, errors.Is(err, errBroke))
+	})
+}
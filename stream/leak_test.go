@@ -0,0 +1,199 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goroutinesSettled waits a little for goroutines that already passed their
+// last synchronization point to actually exit and reports the final count
+func goroutinesSettled(want int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= want || time.Now().After(deadline) {
+			return n
+		}
+		runtime.Gosched()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func assertNoLeaks(t *testing.T, run func()) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	run()
+	if after := goroutinesSettled(before); after > before {
+		buf := make([]byte, 1<<16)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Fatalf("expected %d goroutines, got %d:\n%s", before, after, buf)
+	}
+}
+
+// stubbornSource ignores ctx while sending, only draining lets it finish
+func stubbornSource(n int) stream.Iterable[int, int] {
+	return func(ctx context.Context) <-chan stream.Item[int, int] {
+		resultCh := make(chan stream.Item[int, int])
+		go func() {
+			defer close(resultCh)
+			for i := 0; i < n; i++ {
+				resultCh <- stream.Item[int, int]{Key: i, Value: i}
+			}
+		}()
+		return resultCh
+	}
+}
+
+func Test_MapReduceLeaks(t *testing.T) {
+	const n = 10_000
+
+	in := make([]int, n)
+	for i := range in {
+		in[i] = i
+	}
+
+	identity := func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+		return item, nil
+	}
+
+	sum := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+		return acc + item.Value, nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		assertNoLeaks(t, func() {
+			result, err := stream.MapReduce(context.TODO(), stream.Slice(in), identity, sum, 0, stream.WithConcurrency(8))
+			require.NoError(t, err)
+			assert.Equal(t, n*(n-1)/2, result)
+		})
+	})
+
+	t.Run("error threshold reached by mappers", func(t *testing.T) {
+		failing := func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			return item, fmt.Errorf("item %d failed", item.Key)
+		}
+
+		for _, source := range []stream.Iterable[int, int]{stream.Slice(in), stubbornSource(n)} {
+			assertNoLeaks(t, func() {
+				_, err := stream.MapReduce(
+					context.TODO(),
+					source,
+					failing,
+					sum,
+					0,
+					stream.WithConcurrency(8),
+					stream.ErrorThreshold(3),
+					stream.WithChunkSize(1),
+				)
+				require.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("error threshold reached by the reducer", func(t *testing.T) {
+		failing := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+			return acc, fmt.Errorf("item %d failed", item.Key)
+		}
+
+		assertNoLeaks(t, func() {
+			_, err := stream.MapReduce(context.TODO(), stubbornSource(n), identity, failing, 0, stream.WithConcurrency(8))
+			require.Error(t, err)
+		})
+	})
+
+	t.Run("parent cancellation", func(t *testing.T) {
+		assertNoLeaks(t, func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var seen int32
+			cancelling := func(ctx context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+				if atomic.AddInt32(&seen, 1) == n/2 {
+					cancel()
+				}
+				return item, nil
+			}
+
+			_, err := stream.MapReduce(ctx, stubbornSource(n), cancelling, sum, 0, stream.WithConcurrency(8))
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("parent deadline", func(t *testing.T) {
+		assertNoLeaks(t, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			slow := func(ctx context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+				select {
+				case <-time.After(time.Millisecond):
+				case <-ctx.Done():
+				}
+				return item, nil
+			}
+
+			_, err := stream.MapReduce(ctx, stream.Slice(in), slow, sum, 0, stream.WithConcurrency(4))
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		})
+	})
+
+	t.Run("panicking mapper", func(t *testing.T) {
+		panicking := func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			if item.Key == n/2 {
+				panic("bad item")
+			}
+			return item, nil
+		}
+
+		assertNoLeaks(t, func() {
+			_, err := stream.MapReduce(context.TODO(), stream.Slice(in), panicking, sum, 0, stream.WithConcurrency(8))
+			require.Error(t, err)
+
+			var pErr *stream.PanicError
+			require.True(t, errors.As(err, &pErr))
+			assert.Equal(t, "bad item", pErr.Value)
+			assert.NotEmpty(t, pErr.Stack)
+		})
+	})
+
+	t.Run("panics are returned whatever the error threshold", func(t *testing.T) {
+		panicking := func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			if item.Key == 2 {
+				panic("bad item")
+			}
+			return item, nil
+		}
+
+		_, err := stream.MapReduce(context.TODO(), stream.Slice([]int{1, 2, 3, 4, 5}), panicking, sum, 0, stream.ErrorThreshold(5))
+		var pErr *stream.PanicError
+		require.True(t, errors.As(err, &pErr))
+		assert.Equal(t, "bad item", pErr.Value)
+	})
+
+	t.Run("panicking reducer", func(t *testing.T) {
+		panicking := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+			if item.Key == n/2 {
+				panic("bad item")
+			}
+			return acc + item.Value, nil
+		}
+
+		assertNoLeaks(t, func() {
+			defer func() {
+				assert.Equal(t, "bad item", recover())
+			}()
+
+			_, _ = stream.MapReduce(context.TODO(), stubbornSource(n), identity, panicking, 0, stream.WithConcurrency(8))
+		})
+	})
+}
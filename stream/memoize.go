@@ -0,0 +1,188 @@
+package superstream
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultCacheCapacity = 1024
+
+type (
+	// CacheOptions configure the cache behind a memoized mapper
+	CacheOptions struct {
+		// Capacity is the maximum number of results kept,
+		// the least recently used ones are evicted first
+		Capacity int
+		// TTL limits how long a result is kept, zero keeps it until it is evicted
+		TTL time.Duration
+	}
+
+	cacheEntry[C comparable, O any] struct {
+		key     C
+		result  O
+		skip    bool
+		expires time.Time
+	}
+
+	// inflightCall is a mapper call that concurrent calls for the same key wait for
+	inflightCall[O any] struct {
+		doneCh chan struct{}
+		result O
+		err    error
+	}
+
+	memoCache[C comparable, O any] struct {
+		opts CacheOptions
+
+		mux      sync.Mutex
+		entries  map[C]*list.Element
+		lru      *list.List
+		inflight map[C]*inflightCall[O]
+	}
+)
+
+// Memoize caches the results of the mapper by Item.Key. The returned
+// mapper owns the cache, so reusing it across MapReduce runs reuses the
+// cached results as well. Concurrent calls for a key that is not cached yet
+// wait for a single call to the mapper. Errors are never cached, except for
+// ErrSkip, which is remembered like any other result.
+func Memoize[K comparable, I, O any](
+	m mapper[K, I, O],
+	opts CacheOptions,
+) func(context.Context, Item[K, I]) (Item[K, O], error) {
+	return memoize(m, func(item Item[K, I]) K { return item.Key }, opts, false)
+}
+
+// MemoizeBy works like Memoize but caches results under the key computed by cacheKey.
+// Items with different keys can share a cached result, which is returned with the
+// Item.Key of the item being mapped, whichever item the result was mapped from.
+func MemoizeBy[K comparable, C comparable, I, O any](
+	m mapper[K, I, O],
+	cacheKey func(Item[K, I]) C,
+	opts CacheOptions,
+) func(context.Context, Item[K, I]) (Item[K, O], error) {
+	return memoize(m, cacheKey, opts, true)
+}
+
+// memoize is Memoize and MemoizeBy, rekey gives results the key of the item being mapped
+func memoize[K comparable, C comparable, I, O any](
+	m mapper[K, I, O],
+	cacheKey func(Item[K, I]) C,
+	opts CacheOptions,
+	rekey bool,
+) func(context.Context, Item[K, I]) (Item[K, O], error) {
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultCacheCapacity
+	}
+
+	cache := &memoCache[C, Item[K, O]]{
+		opts:     opts,
+		entries:  make(map[C]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[C]*inflightCall[Item[K, O]]),
+	}
+
+	return func(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+		result, err := cache.get(ctx, cacheKey(item), func() (Item[K, O], error) {
+			return safeMap(ctx, m, item)
+		})
+		if rekey && err == nil {
+			result.Key = item.Key
+		}
+		return result, err
+	}
+}
+
+func (c *memoCache[C, O]) get(ctx context.Context, key C, call func() (O, error)) (O, error) {
+	for {
+		c.mux.Lock()
+		if result, skip, ok := c.lookup(key); ok {
+			c.mux.Unlock()
+			if skip {
+				return result, ErrSkip
+			}
+			return result, nil
+		}
+
+		inflight, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.mux.Unlock()
+
+		select {
+		case <-inflight.doneCh:
+		case <-ctx.Done():
+			return Zero[O](), ctx.Err()
+		}
+
+		// the call ran under the context of whoever made it, which may be
+		// another run that is over by now, that is no reason to fail this one
+		if isContextError(inflight.err) && ctx.Err() == nil {
+			continue
+		}
+		return inflight.result, inflight.err
+	}
+
+	inflight := &inflightCall[O]{doneCh: make(chan struct{})}
+	c.inflight[key] = inflight
+	c.mux.Unlock()
+
+	inflight.result, inflight.err = call()
+
+	c.mux.Lock()
+	delete(c.inflight, key)
+	if inflight.err == nil || errors.Is(inflight.err, ErrSkip) {
+		c.store(key, inflight.result, inflight.err != nil)
+	}
+	c.mux.Unlock()
+	close(inflight.doneCh)
+
+	return inflight.result, inflight.err
+}
+
+// lookup must be called with the lock held
+func (c *memoCache[C, O]) lookup(key C) (O, bool, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return Zero[O](), false, false
+	}
+
+	entry := el.Value.(*cacheEntry[C, O])
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return Zero[O](), false, false
+	}
+
+	c.lru.MoveToFront(el)
+	return entry.result, entry.skip, true
+}
+
+// store must be called with the lock held
+func (c *memoCache[C, O]) store(key C, result O, skip bool) {
+	entry := &cacheEntry[C, O]{key: key, result: result, skip: skip}
+	if c.opts.TTL > 0 {
+		entry.expires = time.Now().Add(c.opts.TTL)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.Capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[C, O]).key)
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,189 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Memoize(t *testing.T) {
+	type lookupItem = stream.Item[int, string]
+
+	var calls int32
+	lookup := func(_ context.Context, item stream.Item[int, int]) (lookupItem, error) {
+		atomic.AddInt32(&calls, 1)
+		return lookupItem{Key: item.Key, Value: "user" + string(rune('A'+item.Value))}, nil
+	}
+
+	count := func(_ context.Context, acc map[string]int, item lookupItem) (map[string]int, error) {
+		acc[item.Value]++
+		return acc, nil
+	}
+
+	t.Run("results are shared by items with the same cache key and across runs", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+
+		ids := []int{1, 2, 1, 3, 2, 1, 1, 3}
+		memoized := stream.MemoizeBy(lookup, func(item stream.Item[int, int]) int {
+			return item.Value
+		}, stream.CacheOptions{Capacity: 10})
+
+		for run := 0; run < 3; run++ {
+			result, err := stream.MapReduce(
+				context.TODO(),
+				stream.Slice(ids),
+				memoized,
+				count,
+				map[string]int{},
+				stream.WithConcurrency(4),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int{"userB": 4, "userC": 2, "userD": 2}, result)
+		}
+
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("shared results keep the key of the item being mapped", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		memoized := stream.MemoizeBy(lookup, func(item stream.Item[int, int]) int {
+			return item.Value
+		}, stream.CacheOptions{})
+
+		for key := 10; key < 13; key++ {
+			result, err := memoized(context.TODO(), stream.Item[int, int]{Key: key, Value: 1})
+			require.NoError(t, err)
+			assert.Equal(t, lookupItem{Key: key, Value: "userB"}, result)
+		}
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("least recently used results are evicted first", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		memoized := stream.Memoize(lookup, stream.CacheOptions{Capacity: 2})
+
+		for _, key := range []int{1, 2, 1, 3, 1, 2} {
+			_, err := memoized(context.TODO(), stream.Item[int, int]{Key: key, Value: key})
+			require.NoError(t, err)
+		}
+
+		// 2 is the least recently used when 3 comes in
+		assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("results expire", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		memoized := stream.Memoize(lookup, stream.CacheOptions{TTL: 10 * time.Millisecond})
+
+		item := stream.Item[int, int]{Key: 1, Value: 1}
+		_, _ = memoized(context.TODO(), item)
+		_, _ = memoized(context.TODO(), item)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		time.Sleep(20 * time.Millisecond)
+		_, _ = memoized(context.TODO(), item)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("concurrent calls for the same key are deduplicated", func(t *testing.T) {
+		var slowCalls int32
+		releaseCh := make(chan struct{})
+		slow := func(_ context.Context, item stream.Item[int, int]) (lookupItem, error) {
+			atomic.AddInt32(&slowCalls, 1)
+			<-releaseCh
+			return lookupItem{Key: item.Key, Value: "done"}, nil
+		}
+
+		memoized := stream.Memoize(slow, stream.CacheOptions{})
+
+		var wg sync.WaitGroup
+		results := make([]string, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				result, err := memoized(context.TODO(), stream.Item[int, int]{Key: 7})
+				assert.NoError(t, err)
+				results[i] = result.Value
+			}(i)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		close(releaseCh)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&slowCalls))
+		for _, result := range results {
+			assert.Equal(t, "done", result)
+		}
+	})
+
+	t.Run("a cancelled caller does not fail the callers waiting on it", func(t *testing.T) {
+		var ctxCalls int32
+		startedCh := make(chan struct{}, 2)
+		bound := func(ctx context.Context, item stream.Item[int, int]) (lookupItem, error) {
+			atomic.AddInt32(&ctxCalls, 1)
+			startedCh <- struct{}{}
+			select {
+			case <-ctx.Done():
+				return lookupItem{}, ctx.Err()
+			case <-time.After(20 * time.Millisecond):
+				return lookupItem{Key: item.Key, Value: "done"}, nil
+			}
+		}
+
+		memoized := stream.Memoize(bound, stream.CacheOptions{})
+		ctx, cancel := context.WithCancel(context.Background())
+
+		firstErrCh := make(chan error, 1)
+		go func() {
+			_, err := memoized(ctx, stream.Item[int, int]{Key: 7})
+			firstErrCh <- err
+		}()
+		<-startedCh
+
+		waiterCh := make(chan lookupItem, 1)
+		go func() {
+			result, err := memoized(context.Background(), stream.Item[int, int]{Key: 7})
+			assert.NoError(t, err)
+			waiterCh <- result
+		}()
+
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+
+		assert.True(t, errors.Is(<-firstErrCh, context.Canceled))
+		assert.Equal(t, "done", (<-waiterCh).Value)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&ctxCalls))
+	})
+
+	t.Run("errors are not cached but skips are", func(t *testing.T) {
+		var failingCalls int32
+		failing := func(_ context.Context, item stream.Item[int, int]) (lookupItem, error) {
+			atomic.AddInt32(&failingCalls, 1)
+			if item.Key == 0 {
+				return lookupItem{}, stream.ErrSkip
+			}
+			return lookupItem{}, errors.New("lookup failed")
+		}
+
+		memoized := stream.Memoize(failing, stream.CacheOptions{})
+		for i := 0; i < 3; i++ {
+			_, err := memoized(context.TODO(), stream.Item[int, int]{Key: 0})
+			assert.True(t, errors.Is(err, stream.ErrSkip))
+
+			_, err = memoized(context.TODO(), stream.Item[int, int]{Key: 1})
+			assert.EqualError(t, err, "lookup failed")
+		}
+
+		assert.Equal(t, int32(4), atomic.LoadInt32(&failingCalls))
+	})
+}
@@ -0,0 +1,39 @@
+package superstream
+
+import (
+	"context"
+)
+
+// operator turns an Iterable into another one by running body between the two.
+// Body emits items until emit reports false, which means ctx is done. Once body
+// returns the upstream source is cancelled and drained, so an operator may stop
+// early and never leaves a goroutine of its source behind.
+func operator[K, V, OK, OV any](
+	iterable Iterable[K, V],
+	body func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[OK, OV]) bool),
+) Iterable[OK, OV] {
+	return func(ctx context.Context) <-chan Item[OK, OV] {
+		resultCh := make(chan Item[OK, OV])
+		upCtx, cancel := context.WithCancel(ctx)
+		inCh := iterable(upCtx)
+
+		go func() {
+			defer close(resultCh)
+			defer func() {
+				cancel()
+				drain(inCh)
+			}()
+
+			body(ctx, inCh, func(item Item[OK, OV]) bool {
+				select {
+				case resultCh <- item:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			})
+		}()
+
+		return resultCh
+	}
+}
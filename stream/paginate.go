@@ -0,0 +1,138 @@
+package superstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultPaginateBackoff = 100 * time.Millisecond
+
+type (
+	// Cursor points at a page of a paginated API, the empty cursor at the first one
+	Cursor string
+
+	// PagePosition is where an item was found, the cursor of its page and its
+	// index in it. Paginate resumes right after it with StartAt set to its
+	// Cursor and StartIndex to its Index plus one.
+	PagePosition struct {
+		Cursor Cursor
+		Index  int
+	}
+
+	// PaginateOptions configures Paginate
+	PaginateOptions struct {
+		// StartAt is the cursor of the first page to fetch
+		StartAt Cursor
+		// StartIndex skips the items of the first page before that index
+		StartIndex int
+		// Retries is how many more times a page is fetched when fetching it fails
+		Retries int
+		// Backoff is the wait before the first retry, doubled before every one
+		// after it, 100ms by default
+		Backoff time.Duration
+		// Clock times the backoff, nil for SystemClock
+		Clock Clock
+	}
+
+	fetchedPage[V any] struct {
+		cursor Cursor
+		items  []V
+	}
+)
+
+// Paginate yields the items of the pages fetch returns, keyed by their position,
+// following the cursors until fetch returns the empty one. The next page is
+// fetched while the items of the current one are consumed. A page that cannot be
+// fetched, retries included, ends the stream and the running MapReduce gets the error.
+func Paginate[V any](fetch func(ctx context.Context, cursor Cursor) ([]V, Cursor, error), opts PaginateOptions) Iterable[PagePosition, V] {
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultPaginateBackoff
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+
+	return func(ctx context.Context) <-chan Item[PagePosition, V] {
+		resultCh := make(chan Item[PagePosition, V])
+		// the fetcher holds on to the next page until the current one is consumed
+		pageCh := make(chan fetchedPage[V])
+
+		go func() {
+			defer close(pageCh)
+
+			cursor := opts.StartAt
+			for {
+				items, next, err := fetchPage(ctx, fetch, cursor, opts)
+				if err != nil {
+					if ctx.Err() == nil {
+						reportSourceError(ctx, fmt.Errorf("paginate error at cursor %q: %w", cursor, err))
+					}
+					return
+				}
+
+				select {
+				case pageCh <- fetchedPage[V]{cursor: cursor, items: items}:
+				case <-ctx.Done():
+					return
+				}
+
+				if next == "" {
+					return
+				}
+				cursor = next
+			}
+		}()
+
+		go func() {
+			defer close(resultCh)
+			// the fetcher is done too by the time the stream is over
+			defer func() {
+				for range pageCh {
+				}
+			}()
+
+			skip := opts.StartIndex
+			for page := range pageCh {
+				for i, v := range page.items {
+					if i < skip {
+						continue
+					}
+
+					select {
+					case resultCh <- Item[PagePosition, V]{Key: PagePosition{Cursor: page.cursor, Index: i}, Value: v}:
+					case <-ctx.Done():
+						return
+					}
+				}
+				skip = 0
+			}
+		}()
+
+		return resultCh
+	}
+}
+
+func fetchPage[V any](
+	ctx context.Context,
+	fetch func(ctx context.Context, cursor Cursor) ([]V, Cursor, error),
+	cursor Cursor,
+	opts PaginateOptions,
+) ([]V, Cursor, error) {
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		items, next, err := fetch(ctx, cursor)
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil {
+			return items, next, err
+		}
+
+		timer := opts.Clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", ctx.Err()
+		}
+		backoff *= 2
+	}
+}
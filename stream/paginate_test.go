@@ -0,0 +1,214 @@
+package superstream_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedAPI serves numbers pageSize at a time, the cursor is the offset of the page,
+// the first request for every page in flaky fails
+type pagedAPI struct {
+	total, pageSize int
+	flaky           map[string]bool
+
+	mux      sync.Mutex
+	requests []string
+}
+
+type pageResponse struct {
+	Items []int  `json:"items"`
+	Next  string `json:"next"`
+}
+
+func (api *pagedAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+
+	api.mux.Lock()
+	api.requests = append(api.requests, cursor)
+	fail := api.flaky[cursor]
+	delete(api.flaky, cursor)
+	api.mux.Unlock()
+
+	if fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	offset, _ := strconv.Atoi(cursor)
+	var resp pageResponse
+	for i := offset; i < offset+api.pageSize && i < api.total; i++ {
+		resp.Items = append(resp.Items, i)
+	}
+	if offset+api.pageSize < api.total {
+		resp.Next = strconv.Itoa(offset + api.pageSize)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (api *pagedAPI) requestCount() int {
+	api.mux.Lock()
+	defer api.mux.Unlock()
+	return len(api.requests)
+}
+
+func fetchFrom(url string) func(context.Context, stream.Cursor) ([]int, stream.Cursor, error) {
+	return func(ctx context.Context, cursor stream.Cursor) ([]int, stream.Cursor, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"?cursor="+string(cursor), nil)
+		if err != nil {
+			return nil, "", err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+
+		var page pageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return nil, "", err
+		}
+		return page.Items, stream.Cursor(page.Next), nil
+	}
+}
+
+func Test_Paginate(t *testing.T) {
+	values := func(items []stream.Item[stream.PagePosition, int]) []int {
+		result := make([]int, 0, len(items))
+		for _, item := range items {
+			result = append(result, item.Value)
+		}
+		return result
+	}
+	upTo := func(n int) []int {
+		result := make([]int, n)
+		for i := range result {
+			result[i] = i
+		}
+		return result
+	}
+
+	t.Run("pages are flattened", func(t *testing.T) {
+		api := &pagedAPI{total: 25, pageSize: 10}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		items := collect(stream.Paginate(fetchFrom(srv.URL), stream.PaginateOptions{}))
+		assert.Equal(t, upTo(25), values(items))
+		assert.Equal(t, stream.PagePosition{Cursor: "", Index: 0}, items[0].Key)
+		assert.Equal(t, stream.PagePosition{Cursor: "20", Index: 4}, items[24].Key)
+		assert.Equal(t, []string{"", "10", "20"}, api.requests)
+	})
+
+	t.Run("the next page is prefetched", func(t *testing.T) {
+		api := &pagedAPI{total: 30, pageSize: 10}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		out := stream.Paginate(fetchFrom(srv.URL), stream.PaginateOptions{})(ctx)
+
+		assert.Equal(t, 0, receive(t, out).Value)
+		deadline := time.Now().Add(time.Second)
+		for api.requestCount() < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, 2, api.requestCount(), "the second page is fetched while the first is consumed")
+	})
+
+	t.Run("failed fetches are retried", func(t *testing.T) {
+		api := &pagedAPI{total: 25, pageSize: 10, flaky: map[string]bool{"10": true}}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		items := collect(stream.Paginate(fetchFrom(srv.URL), stream.PaginateOptions{Retries: 1, Backoff: time.Millisecond}))
+		assert.Equal(t, upTo(25), values(items))
+		assert.Equal(t, []string{"", "10", "10", "20"}, api.requests)
+	})
+
+	t.Run("fetch errors reach MapReduce", func(t *testing.T) {
+		api := &pagedAPI{total: 25, pageSize: 10, flaky: map[string]bool{"10": true}}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		count, err := stream.MapReduce(
+			context.TODO(),
+			stream.Paginate(fetchFrom(srv.URL), stream.PaginateOptions{}),
+			func(_ context.Context, item stream.Item[stream.PagePosition, int]) (stream.Item[stream.PagePosition, int], error) {
+				return item, nil
+			},
+			func(_ context.Context, acc int, _ stream.Item[stream.PagePosition, int]) (int, error) {
+				return acc + 1, nil
+			},
+			0,
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `cursor "10"`)
+		assert.Equal(t, 10, count)
+	})
+
+	t.Run("resuming from a checkpoint", func(t *testing.T) {
+		api := &pagedAPI{total: 25, pageSize: 10}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		var checkpoint stream.PagePosition
+		errStop := errors.New("stop")
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Paginate(fetchFrom(srv.URL), stream.PaginateOptions{}),
+			func(_ context.Context, item stream.Item[stream.PagePosition, int]) (stream.Item[stream.PagePosition, int], error) {
+				return item, nil
+			},
+			func(_ context.Context, acc int, item stream.Item[stream.PagePosition, int]) (int, error) {
+				if item.Value == 13 {
+					return acc, errStop
+				}
+				checkpoint = item.Key
+				return acc, nil
+			},
+			0,
+		)
+		require.ErrorIs(t, err, errStop)
+		assert.Equal(t, stream.PagePosition{Cursor: "10", Index: 2}, checkpoint)
+
+		var rest []int
+		resumed := stream.PaginateOptions{StartAt: checkpoint.Cursor, StartIndex: checkpoint.Index + 1}
+		for _, item := range collect(stream.Paginate(fetchFrom(srv.URL), resumed)) {
+			rest = append(rest, item.Value)
+		}
+		assert.Equal(t, upTo(25)[13:], rest)
+	})
+
+	t.Run("no leaks when stopped early", func(t *testing.T) {
+		api := &pagedAPI{total: 1000, pageSize: 10}
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		assertNoLeaks(t, func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			out := stream.Paginate(fetchFrom(srv.URL), stream.PaginateOptions{})(ctx)
+			receive(t, out)
+			cancel()
+			for range out {
+			}
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package superstream
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// rangeOffer lets MapReduce read the items of a source by index
+	rangeOffer[K, V any] struct {
+		n       int
+		at      func(i int) Item[K, V]
+		claimCh chan struct{}
+	}
+
+	// indexRange is the part of the source a worker has left to map
+	indexRange struct {
+		mux    sync.Mutex
+		lo, hi int
+	}
+
+	// rangeDispatcher gives every worker a contiguous range of indexes
+	// and lets the workers that run out of work steal from the others
+	rangeDispatcher[K comparable, I any] struct {
+		ranges    []*indexRange
+		at        func(i int) Item[K, I]
+		chunkSize int
+	}
+)
+
+// ParallelSlice works like Slice, except that MapReduce does not push its items
+// through a channel: the slice is split into contiguous ranges of indexes,
+// one per worker, and every worker maps its own range. A worker that is done
+// with its range takes over half of what is left of the busiest one.
+func ParallelSlice[V any](items []V) Iterable[int, V] {
+	return func(ctx context.Context) <-chan Item[int, V] {
+		resultCh := make(chan Item[int, V])
+		hintSize[int, V](ctx, resultCh, len(items))
+		claimCh := offerRanges(ctx, resultCh, len(items), func(i int) Item[int, V] {
+			return Item[int, V]{Key: i, Value: items[i]}
+		})
+
+		go func() {
+			defer close(resultCh)
+			for i := 0; i < len(items); i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case <-claimCh:
+					// the items are read by index from now on
+					return
+				case resultCh <- Item[int, V]{Key: i, Value: items[i]}:
+				}
+			}
+		}()
+
+		return resultCh
+	}
+}
+
+func offerRanges[K, V any](
+	ctx context.Context,
+	resultCh chan Item[K, V],
+	n int,
+	at func(i int) Item[K, V],
+) <-chan struct{} {
+	h := runHooksFrom(ctx)
+	if h == nil {
+		return nil
+	}
+
+	o := &rangeOffer[K, V]{n: n, at: at, claimCh: make(chan struct{}, 1)}
+	h.offer((<-chan Item[K, V])(resultCh), o)
+	return o.claimCh
+}
+
+// claimRanges takes the offer to read the items of inCh by index if there is one
+func claimRanges[K, V any](ctx context.Context, inCh <-chan Item[K, V]) (*rangeOffer[K, V], bool) {
+	h := runHooksFrom(ctx)
+	if h == nil {
+		return nil, false
+	}
+
+	o, ok := h.lookup(inCh)
+	if !ok {
+		return nil, false
+	}
+
+	offer, ok := o.(*rangeOffer[K, V])
+	if !ok {
+		return nil, false
+	}
+
+	offer.claimCh <- struct{}{}
+	return offer, true
+}
+
+func newRangeDispatcher[K comparable, I any](fc *flowControl, offer *rangeOffer[K, I]) *rangeDispatcher[K, I] {
+	d := &rangeDispatcher[K, I]{
+		ranges:    make([]*indexRange, fc.concurrency),
+		at:        offer.at,
+		chunkSize: fc.chunkSize,
+	}
+
+	for w := range d.ranges {
+		d.ranges[w] = &indexRange{
+			lo: offer.n * w / fc.concurrency,
+			hi: offer.n * (w + 1) / fc.concurrency,
+		}
+	}
+
+	return d
+}
+
+func (d *rangeDispatcher[K, I]) next(ctx context.Context, worker int) ([]Item[K, I], bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+
+	own := d.ranges[worker]
+	lo, hi := own.take(d.chunkSize)
+	if lo == hi {
+		if !d.steal(worker) {
+			return nil, false
+		}
+		lo, hi = own.take(d.chunkSize)
+	}
+
+	chunk := make([]Item[K, I], 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		chunk = append(chunk, d.at(i))
+	}
+
+	return chunk, true
+}
+
+// steal moves the upper half of what the busiest other worker has left to the thief
+func (d *rangeDispatcher[K, I]) steal(thief int) bool {
+	for {
+		victim, most := -1, 0
+		for w, r := range d.ranges {
+			if w == thief {
+				continue
+			}
+			if left := r.left(); left > most {
+				victim, most = w, left
+			}
+		}
+
+		if victim < 0 {
+			return false
+		}
+
+		r := d.ranges[victim]
+		r.mux.Lock()
+		left := r.hi - r.lo
+		if left == 0 {
+			// somebody got there first, look for another victim
+			r.mux.Unlock()
+			continue
+		}
+
+		mid := r.lo + left/2
+		stolenLo, stolenHi := mid, r.hi
+		r.hi = mid
+		r.mux.Unlock()
+
+		own := d.ranges[thief]
+		own.mux.Lock()
+		own.lo, own.hi = stolenLo, stolenHi
+		own.mux.Unlock()
+		return true
+	}
+}
+
+func (r *indexRange) take(n int) (int, int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	lo := r.lo
+	if r.hi-lo < n {
+		n = r.hi - lo
+	}
+	r.lo += n
+	return lo, r.lo
+}
+
+func (r *indexRange) left() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.hi - r.lo
+}
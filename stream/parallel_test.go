@@ -0,0 +1,127 @@
+package superstream_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParallelSlice(t *testing.T) {
+	type intItem = stream.Item[int, int]
+
+	t.Run("keys keep the original indexes", func(t *testing.T) {
+		const n = 10_001
+		in := make([]int, n)
+		for i := range in {
+			in[i] = i * 10
+		}
+
+		mapper := func(_ context.Context, item intItem) (intItem, error) {
+			if item.Value != item.Key*10 {
+				t.Errorf("item %d has value %d", item.Key, item.Value)
+			}
+			return item, nil
+		}
+
+		for _, concurrency := range []int{1, 3, 8} {
+			seen, err := stream.MapReduce(
+				context.TODO(),
+				stream.ParallelSlice(in),
+				mapper,
+				func(_ context.Context, acc []bool, item intItem) ([]bool, error) {
+					require.False(t, acc[item.Key], "item %d seen twice", item.Key)
+					acc[item.Key] = true
+					return acc, nil
+				},
+				make([]bool, n),
+				stream.WithConcurrency(concurrency),
+				stream.WithChunkSize(16),
+			)
+			require.NoError(t, err)
+
+			for i := range seen {
+				require.True(t, seen[i], "item %d is missing", i)
+			}
+		}
+	})
+
+	t.Run("idle workers steal from busy ones", func(t *testing.T) {
+		const n = 400
+		in := make([]int, n)
+
+		var inFlight, maxInFlight int32
+		var mux sync.Mutex
+		mapper := func(_ context.Context, item intItem) (intItem, error) {
+			// all the expensive items are in the range of the first worker
+			if item.Key < n/4 {
+				current := atomic.AddInt32(&inFlight, 1)
+				mux.Lock()
+				if current > maxInFlight {
+					maxInFlight = current
+				}
+				mux.Unlock()
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+			}
+			return item, nil
+		}
+
+		count, err := stream.MapReduce(
+			context.TODO(),
+			stream.ParallelSlice(in),
+			mapper,
+			func(_ context.Context, acc int, item intItem) (int, error) {
+				return acc + 1, nil
+			},
+			0,
+			stream.WithConcurrency(4),
+			stream.WithChunkSize(1),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, n, count)
+		assert.True(t, maxInFlight > 1, "expected expensive items to be mapped concurrently")
+	})
+
+	t.Run("behaves like slice outside map reduce", func(t *testing.T) {
+		items := collect(stream.ParallelSlice([]string{"a", "b", "c"}))
+		assert.Equal(t, []int{0, 1, 2}, keys(items))
+
+		wrapped := stream.SampleFraction(stream.ParallelSlice([]int{1, 2, 3, 4}), 1, 1)
+		count, err := stream.MapReduce(
+			context.TODO(),
+			wrapped,
+			func(_ context.Context, item intItem) (intItem, error) { return item, nil },
+			func(_ context.Context, acc int, item intItem) (int, error) { return acc + item.Value, nil },
+			0,
+			stream.WithConcurrency(2),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 10, count)
+	})
+
+	t.Run("stops on errors without leaks", func(t *testing.T) {
+		in := make([]int, 10_000)
+		assertNoLeaks(t, func() {
+			_, err := stream.MapReduce(
+				context.TODO(),
+				stream.ParallelSlice(in),
+				func(_ context.Context, item intItem) (intItem, error) {
+					if item.Key == 5_000 {
+						return item, assert.AnError
+					}
+					return item, nil
+				},
+				func(_ context.Context, acc int, item intItem) (int, error) { return acc, nil },
+				0,
+				stream.WithConcurrency(4),
+			)
+			require.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+package superstream
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	itemPriority struct {
+		// fn is a func(Item[K, I]) int
+		fn    any
+		aging time.Duration
+	}
+
+	prioritized[K, I any] struct {
+		item Item[K, I]
+		// score orders the items, aging included, seq keeps equal scores in arrival order
+		score float64
+		seq   uint64
+	}
+
+	priorityHeap[K, I any] []prioritized[K, I]
+
+	// priorityDispatcher keeps the items waiting for a mapper in a bounded
+	// priority queue and hands them out one at a time, best first
+	priorityDispatcher[K comparable, I any] struct {
+		outCh chan Item[K, I]
+	}
+)
+
+// WithPriority makes the mappers take the waiting item with the highest priority
+// first instead of the one that came first. Up to WithQueueSize items wait in a
+// priority queue, so priorities only matter once a backlog builds up.
+// Use WithPriorityAging to keep low priority items from starving.
+func WithPriority[K, I any](priority func(Item[K, I]) int) reducerOption {
+	return func(fc *flowControl) {
+		if fc.priority == nil {
+			fc.priority = &itemPriority{}
+		}
+		fc.priority.fn = priority
+	}
+}
+
+// WithPriorityAging raises the priority of a waiting item by one for every step it waits
+func WithPriorityAging(step time.Duration) reducerOption {
+	return func(fc *flowControl) {
+		if fc.priority == nil {
+			fc.priority = &itemPriority{}
+		}
+		if step > 0 {
+			fc.priority.aging = step
+		}
+	}
+}
+
+func priorityFunc[K comparable, I any](fc *flowControl) (func(Item[K, I]) int, error) {
+	priority, ok := fc.priority.fn.(func(Item[K, I]) int)
+	if !ok || priority == nil {
+		return nil, fmt.Errorf(
+			"%w: WithPriority expects a %T, got a %T",
+			ErrInvalidOption, priority, fc.priority.fn,
+		)
+	}
+
+	return priority, nil
+}
+
+func (h priorityHeap[K, I]) Len() int {
+	return len(h)
+}
+
+func (h priorityHeap[K, I]) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap[K, I]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *priorityHeap[K, I]) Push(x any) {
+	*h = append(*h, x.(prioritized[K, I]))
+}
+
+func (h *priorityHeap[K, I]) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+func newPriorityDispatcher[K comparable, I any](
+	ctx context.Context,
+	fc *flowControl,
+	tasks *sync.WaitGroup,
+	src dispatcher[K, I],
+	priority func(Item[K, I]) int,
+) *priorityDispatcher[K, I] {
+	d := &priorityDispatcher[K, I]{outCh: make(chan Item[K, I])}
+	srcCh := make(chan Item[K, I])
+	started := time.Now()
+	aging := fc.priority.aging
+
+	tasks.Add(2)
+	go func() {
+		defer tasks.Done()
+		defer close(srcCh)
+		for {
+			chunk, ok := src.next(ctx, 0)
+			if !ok {
+				return
+			}
+			for _, item := range chunk {
+				select {
+				case srcCh <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer tasks.Done()
+		defer close(d.outCh)
+
+		// an item that waited for a whole step is worth one more point of priority,
+		// which is the same as every later arrival being worth one point less
+		var waiting priorityHeap[K, I]
+		var seq uint64
+		inCh := srcCh
+
+		for inCh != nil || len(waiting) > 0 {
+			var outCh chan Item[K, I]
+			var best Item[K, I]
+			if len(waiting) > 0 {
+				outCh = d.outCh
+				best = waiting[0].item
+			}
+
+			acceptCh := inCh
+			if len(waiting) >= fc.queueSize {
+				acceptCh = nil
+			}
+
+			select {
+			case item, ok := <-acceptCh:
+				if !ok {
+					inCh = nil
+					continue
+				}
+
+				score := float64(priority(item))
+				if aging > 0 {
+					score -= float64(time.Since(started)) / float64(aging)
+				}
+				heap.Push(&waiting, prioritized[K, I]{item: item, score: score, seq: seq})
+				seq++
+			case outCh <- best:
+				heap.Pop(&waiting)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return d
+}
+
+func (d *priorityDispatcher[K, I]) next(ctx context.Context, _ int) ([]Item[K, I], bool) {
+	select {
+	case item, ok := <-d.outCh:
+		if !ok {
+			return nil, false
+		}
+		return []Item[K, I]{item}, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
@@ -0,0 +1,170 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type job = stream.Item[string, int]
+
+// jobSource yields the jobs of every batch, waiting pause between batches
+func jobSource(pause time.Duration, batches ...[]job) stream.Iterable[string, int] {
+	return func(ctx context.Context) <-chan job {
+		resultCh := make(chan job)
+		go func() {
+			defer close(resultCh)
+			for i, batch := range batches {
+				if i > 0 {
+					time.Sleep(pause)
+				}
+				for _, j := range batch {
+					select {
+					case resultCh <- j:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		return resultCh
+	}
+}
+
+// gatedOrder records the order jobs are mapped in, the first job
+// holds the only mapper until the gate opens so that a backlog builds up
+type gatedOrder struct {
+	once   sync.Once
+	gateCh chan struct{}
+	mux    sync.Mutex
+	order  []string
+}
+
+func newGatedOrder() *gatedOrder {
+	return &gatedOrder{gateCh: make(chan struct{})}
+}
+
+func (g *gatedOrder) mapper(_ context.Context, item job) (job, error) {
+	first := false
+	g.once.Do(func() { first = true })
+	if first {
+		<-g.gateCh
+	}
+
+	g.mux.Lock()
+	g.order = append(g.order, item.Key)
+	g.mux.Unlock()
+	return item, nil
+}
+
+func (g *gatedOrder) openAfter(d time.Duration) {
+	time.AfterFunc(d, func() { close(g.gateCh) })
+}
+
+func Test_Priority(t *testing.T) {
+	byValue := func(item job) int { return item.Value }
+	count := func(_ context.Context, acc int, item job) (int, error) { return acc + 1, nil }
+
+	t.Run("highest priority first", func(t *testing.T) {
+		g := newGatedOrder()
+		g.openAfter(30 * time.Millisecond)
+
+		result, err := stream.MapReduce(
+			context.TODO(),
+			jobSource(0, []job{
+				{Key: "first", Value: 0},
+				{Key: "free-1", Value: 0},
+				{Key: "retry", Value: 5},
+				{Key: "free-2", Value: 0},
+				{Key: "paying", Value: 10},
+				{Key: "free-3", Value: 0},
+				{Key: "retry-2", Value: 5},
+			}),
+			g.mapper,
+			count,
+			0,
+			stream.WithPriority(byValue),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 7, result)
+		assert.Equal(t, []string{"first", "paying", "retry", "retry-2", "free-1", "free-2", "free-3"}, g.order)
+	})
+
+	t.Run("aging keeps low priority items from starving", func(t *testing.T) {
+		batches := [][]job{
+			{{Key: "first", Value: 0}, {Key: "old-low", Value: 0}},
+			{{Key: "new-high", Value: 2}},
+		}
+
+		for _, tc := range []struct {
+			name   string
+			aging  time.Duration
+			expect []string
+		}{
+			{name: "without aging", expect: []string{"first", "new-high", "old-low"}},
+			{name: "with aging", aging: 10 * time.Millisecond, expect: []string{"first", "old-low", "new-high"}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				g := newGatedOrder()
+				g.openAfter(80 * time.Millisecond)
+
+				_, err := stream.MapReduce(
+					context.TODO(),
+					jobSource(50*time.Millisecond, batches...),
+					g.mapper,
+					count,
+					0,
+					stream.WithPriority(byValue),
+					stream.WithPriorityAging(tc.aging),
+				)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expect, g.order)
+			})
+		}
+	})
+
+	t.Run("bounded buffer", func(t *testing.T) {
+		in := make([]int, 1000)
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) { return item, nil },
+			func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) { return acc + 1, nil },
+			0,
+			stream.WithConcurrency(4),
+			stream.WithQueueSize(3),
+			stream.WithPriority(func(item stream.Item[int, int]) int { return item.Key % 7 }),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 1000, result)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			jobSource(0, []job{{Key: "a"}}),
+			func(_ context.Context, item job) (job, error) { return item, nil },
+			count,
+			0,
+			stream.WithPriority(func(stream.Item[int, int]) int { return 0 }),
+		)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+
+		_, err = stream.MapReduce(
+			context.TODO(),
+			jobSource(0, []job{{Key: "a"}}),
+			func(_ context.Context, item job) (job, error) { return item, nil },
+			count,
+			0,
+			stream.WithPriority(byValue),
+			stream.WithKeyAffinity[string](nil),
+		)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+	})
+}
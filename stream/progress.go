@@ -0,0 +1,127 @@
+package superstream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultProgressInterval = time.Second
+
+type (
+	// Stats counts what happened to the items of a run so far
+	Stats struct {
+		// Processed is the number of items that made it through the reducer
+		Processed int64
+		// Skipped is the number of items the mappers skipped with ErrSkip
+		Skipped int64
+		// Failed is the number of items that failed to map or to reduce
+		Failed int64
+		// Hedged is the number of duplicate mapper calls started by WithHedging
+		Hedged int64
+		// HedgeWins is the number of items a duplicate mapper call finished first
+		HedgeWins int64
+	}
+
+	// Progress is a snapshot of a running MapReduce
+	Progress struct {
+		Stats
+		// Total is the number of items the source is going to yield or -1 if it is unknown
+		Total int64
+		// Elapsed is the time since the run started
+		Elapsed time.Duration
+		// Throughput is the average number of items handled per second
+		Throughput float64
+		// ETA is the estimated time left, it is zero when Total is unknown
+		ETA time.Duration
+	}
+
+	progressReporter struct {
+		report   func(Progress)
+		interval time.Duration
+	}
+)
+
+// WithProgress calls report at a regular interval while MapReduce runs and
+// once more with the final numbers just before it returns. Use WithProgressInterval
+// to change how often that happens, the default is once a second.
+func WithProgress(report func(Progress)) reducerOption {
+	return func(fc *flowControl) {
+		fc.progress.report = report
+	}
+}
+
+func WithProgressInterval(d time.Duration) reducerOption {
+	return func(fc *flowControl) {
+		if d > 0 {
+			fc.progress.interval = d
+		}
+	}
+}
+
+func (s *Stats) snapshot() Stats {
+	return Stats{
+		Processed: atomic.LoadInt64(&s.Processed),
+		Skipped:   atomic.LoadInt64(&s.Skipped),
+		Failed:    atomic.LoadInt64(&s.Failed),
+		Hedged:    atomic.LoadInt64(&s.Hedged),
+		HedgeWins: atomic.LoadInt64(&s.HedgeWins),
+	}
+}
+
+func (s Stats) handled() int64 {
+	return s.Processed + s.Skipped + s.Failed
+}
+
+func newProgress(stats Stats, total int64, elapsed time.Duration) Progress {
+	p := Progress{Stats: stats, Total: total, Elapsed: elapsed}
+	if elapsed > 0 {
+		p.Throughput = float64(stats.handled()) / elapsed.Seconds()
+	}
+
+	if total >= 0 && p.Throughput > 0 {
+		if left := total - stats.handled(); left > 0 {
+			p.ETA = time.Duration(float64(left) / p.Throughput * float64(time.Second))
+		}
+	}
+
+	return p
+}
+
+// run reports the progress until ctx is done, the caller is responsible
+// for the final report, once nothing can change the numbers anymore
+func (pr *progressReporter) run(
+	ctx context.Context,
+	tasks *sync.WaitGroup,
+	stats *Stats,
+	total int64,
+	started time.Time,
+) {
+	if pr.report == nil {
+		return
+	}
+
+	tasks.Add(1)
+	go func() {
+		defer tasks.Done()
+
+		ticker := time.NewTicker(pr.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				pr.report(newProgress(stats.snapshot(), total, time.Since(started)))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (pr *progressReporter) final(stats *Stats, total int64, started time.Time) {
+	if pr.report != nil {
+		pr.report(newProgress(stats.snapshot(), total, time.Since(started)))
+	}
+}
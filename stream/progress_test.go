@@ -0,0 +1,182 @@
+package superstream_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type progressLog struct {
+	mux     sync.Mutex
+	reports []stream.Progress
+}
+
+func (l *progressLog) report(p stream.Progress) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.reports = append(l.reports, p)
+}
+
+func (l *progressLog) last() stream.Progress {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.reports[len(l.reports)-1]
+}
+
+func (l *progressLog) len() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return len(l.reports)
+}
+
+func Test_Progress(t *testing.T) {
+	const n = 200
+
+	type intItem = stream.Item[int, int]
+
+	in := make([]int, n)
+	for i := range in {
+		in[i] = i
+	}
+
+	mapper := func(_ context.Context, item intItem) (intItem, error) {
+		time.Sleep(100 * time.Microsecond)
+		switch {
+		case item.Key%10 == 0:
+			return intItem{}, stream.ErrSkip
+		case item.Key%25 == 1:
+			return intItem{}, fmt.Errorf("item %d failed", item.Key)
+		}
+		return item, nil
+	}
+
+	reducer := func(_ context.Context, acc int, item intItem) (int, error) {
+		return acc + 1, nil
+	}
+
+	t.Run("slice source has a known total", func(t *testing.T) {
+		var log progressLog
+
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			mapper,
+			reducer,
+			0,
+			stream.WithConcurrency(4),
+			stream.WithChunkSize(4),
+			stream.ErrorThreshold(n),
+			stream.WithProgress(log.report),
+			stream.WithProgressInterval(time.Millisecond),
+		)
+		require.NoError(t, err)
+
+		final := log.last()
+		assert.Equal(t, int64(n), final.Total)
+		assert.Equal(t, int64(result), final.Processed)
+		assert.Equal(t, int64(20), final.Skipped)
+		assert.Equal(t, int64(8), final.Failed)
+		assert.Equal(t, time.Duration(0), final.ETA)
+		assert.True(t, final.Throughput > 0)
+		assert.True(t, final.Elapsed > 0)
+
+		for _, p := range log.reports {
+			assert.True(t, p.Processed+p.Skipped+p.Failed <= p.Total)
+		}
+	})
+
+	t.Run("map source has a known total", func(t *testing.T) {
+		m := make(map[string]int, n)
+		for i := 0; i < n; i++ {
+			m[fmt.Sprintf("%d", i)] = i
+		}
+
+		var log progressLog
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Map(m),
+			func(_ context.Context, item stream.Item[string, int]) (stream.Item[string, int], error) {
+				return item, nil
+			},
+			func(_ context.Context, acc int, item stream.Item[string, int]) (int, error) {
+				return acc + item.Value, nil
+			},
+			0,
+			stream.WithProgress(log.report),
+		)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, log.len())
+		assert.Equal(t, int64(n), log.last().Total)
+		assert.Equal(t, int64(n), log.last().Processed)
+	})
+
+	t.Run("sources of unknown length", func(t *testing.T) {
+		var log progressLog
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stubbornSource(n),
+			mapper,
+			reducer,
+			0,
+			stream.ErrorThreshold(n),
+			stream.WithProgress(log.report),
+		)
+		require.NoError(t, err)
+
+		final := log.last()
+		assert.Equal(t, int64(-1), final.Total)
+		assert.Equal(t, time.Duration(0), final.ETA)
+		assert.Equal(t, int64(n), final.Processed+final.Skipped+final.Failed)
+	})
+
+	t.Run("sized sources of unknown length", func(t *testing.T) {
+		var log progressLog
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Sized(stubbornSource(n), n),
+			mapper,
+			reducer,
+			0,
+			stream.ErrorThreshold(n),
+			stream.WithProgress(log.report),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, int64(n), log.last().Total)
+	})
+
+	t.Run("estimated time left", func(t *testing.T) {
+		var log progressLog
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// the run is cancelled half way through, so some work is left
+		_, err := stream.MapReduce(
+			ctx,
+			stream.Slice(in),
+			func(_ context.Context, item intItem) (intItem, error) {
+				if item.Key == n/2 {
+					cancel()
+				}
+				time.Sleep(100 * time.Microsecond)
+				return item, nil
+			},
+			reducer,
+			0,
+			stream.WithChunkSize(1),
+			stream.WithProgress(log.report),
+		)
+		require.NoError(t, err)
+
+		final := log.last()
+		assert.True(t, final.Processed < n)
+		assert.True(t, final.ETA > 0)
+	})
+}
@@ -0,0 +1,100 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Recorded is an item the way Record saves it, At is the time it arrived at
+// since the recorded stream started
+type Recorded[K, V any] struct {
+	At    time.Duration
+	Key   K
+	Value V
+}
+
+// Record passes the items of the iterable through unchanged and saves every one
+// of them, along with when it arrived according to clock, to w. Failing to save
+// an item ends the stream and the running MapReduce gets the error.
+func Record[K, V any](iterable Iterable[K, V], w io.Writer, codec Codec[Recorded[K, V]], clock Clock) Iterable[K, V] {
+	clock = clockOrSystem(clock)
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		enc := codec.NewEncoder(w)
+		started := clock.Now()
+
+		for item := range inCh {
+			rec := Recorded[K, V]{At: clock.Now().Sub(started), Key: item.Key, Value: item.Value}
+			if err := enc.Encode(rec); err != nil {
+				reportSourceError(ctx, fmt.Errorf("record error: %w", err))
+				return
+			}
+
+			if !emit(item) {
+				return
+			}
+		}
+	})
+}
+
+// Replay yields the items saved by Record as fast as they can be read from r.
+// A recording can be replayed once, decoding errors end the stream and the
+// running MapReduce gets them.
+func Replay[K, V any](r io.Reader, codec Codec[Recorded[K, V]]) Iterable[K, V] {
+	return replay(r, codec, nil)
+}
+
+// ReplayPaced yields the items saved by Record keeping the intervals
+// between them as they were recorded, as measured by clock.
+func ReplayPaced[K, V any](r io.Reader, codec Codec[Recorded[K, V]], clock Clock) Iterable[K, V] {
+	// replay takes a nil clock for no pacing at all
+	return replay(r, codec, clockOrSystem(clock))
+}
+
+func replay[K, V any](r io.Reader, codec Codec[Recorded[K, V]], clock Clock) Iterable[K, V] {
+	return func(ctx context.Context) <-chan Item[K, V] {
+		resultCh := make(chan Item[K, V])
+		go func() {
+			defer close(resultCh)
+
+			dec := codec.NewDecoder(r)
+			var started time.Time
+			if clock != nil {
+				started = clock.Now()
+			}
+
+			for {
+				rec, err := dec.Decode()
+				if errors.Is(err, io.EOF) {
+					return
+				}
+
+				if err != nil {
+					reportSourceError(ctx, fmt.Errorf("replay error: %w", err))
+					return
+				}
+
+				if clock != nil {
+					if wait := rec.At - clock.Now().Sub(started); wait > 0 {
+						timer := clock.NewTimer(wait)
+						select {
+						case <-timer.C():
+						case <-ctx.Done():
+							timer.Stop()
+							return
+						}
+					}
+				}
+
+				select {
+				case resultCh <- Item[K, V]{Key: rec.Key, Value: rec.Value}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return resultCh
+	}
+}
@@ -0,0 +1,122 @@
+package superstream_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RecordReplay(t *testing.T) {
+	start := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("record saves items with their timing", func(t *testing.T) {
+		for name, codec := range map[string]stream.Codec[stream.Recorded[int, string]]{
+			"json": stream.JSONCodec[stream.Recorded[int, string]](),
+			"gob":  stream.GobCodec[stream.Recorded[int, string]](),
+		} {
+			t.Run(name, func(t *testing.T) {
+				clock := stream.NewManualClock(start)
+				src := make(chan timedItem)
+				var buf bytes.Buffer
+				out := stream.Record(manualSource(src), &buf, codec, clock)(context.Background())
+
+				src <- timedItem{Key: 1, Value: "a"}
+				assert.Equal(t, timedItem{Key: 1, Value: "a"}, receive(t, out))
+				clock.Advance(5 * time.Millisecond)
+				src <- timedItem{Key: 2, Value: "b"}
+				assert.Equal(t, timedItem{Key: 2, Value: "b"}, receive(t, out))
+				close(src)
+				assertClosed(t, out)
+
+				dec := codec.NewDecoder(bytes.NewReader(buf.Bytes()))
+				first, err := dec.Decode()
+				require.NoError(t, err)
+				second, err := dec.Decode()
+				require.NoError(t, err)
+				assert.Equal(t, stream.Recorded[int, string]{At: 0, Key: 1, Value: "a"}, first)
+				assert.Equal(t, stream.Recorded[int, string]{At: 5 * time.Millisecond, Key: 2, Value: "b"}, second)
+
+				replayed := collect(stream.Replay(bytes.NewReader(buf.Bytes()), codec))
+				assert.Equal(t, []timedItem{{Key: 1, Value: "a"}, {Key: 2, Value: "b"}}, replayed)
+			})
+		}
+	})
+
+	t.Run("paced replay keeps the intervals", func(t *testing.T) {
+		codec := stream.JSONCodec[stream.Recorded[int, string]]()
+		var buf bytes.Buffer
+		enc := codec.NewEncoder(&buf)
+		for _, rec := range []stream.Recorded[int, string]{
+			{At: 0, Key: 1},
+			{At: 10 * time.Millisecond, Key: 2},
+			{At: 30 * time.Millisecond, Key: 3},
+		} {
+			require.NoError(t, enc.Encode(rec))
+		}
+
+		clock := stream.NewManualClock(start)
+		out := stream.ReplayPaced(&buf, codec, clock)(context.Background())
+
+		assert.Equal(t, 1, receive(t, out).Key)
+		clock.BlockUntilTimers(1)
+		clock.Advance(10 * time.Millisecond)
+		assert.Equal(t, 2, receive(t, out).Key)
+		clock.BlockUntilTimers(2)
+		clock.Advance(20 * time.Millisecond)
+		assert.Equal(t, 3, receive(t, out).Key)
+		assertClosed(t, out)
+	})
+
+	t.Run("rerunning a recorded MapReduce", func(t *testing.T) {
+		codec := stream.GobCodec[stream.Recorded[int, int]]()
+		sum := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+			return acc*31 + item.Value, nil
+		}
+		identity := func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			return item, nil
+		}
+
+		var buf bytes.Buffer
+		recorded, err := stream.MapReduce(
+			context.TODO(),
+			stream.Record(stream.Slice([]int{3, 1, 4, 1, 5, 9, 2, 6}), &buf, codec, stream.SystemClock),
+			identity,
+			sum,
+			0,
+		)
+		require.NoError(t, err)
+
+		replayed, err := stream.MapReduce(context.TODO(), stream.Replay(&buf, codec), identity, sum, 0)
+		require.NoError(t, err)
+		assert.Equal(t, recorded, replayed)
+	})
+
+	t.Run("a nil clock is the system clock", func(t *testing.T) {
+		codec := stream.JSONCodec[stream.Recorded[int, string]]()
+		words := []string{"a", "b"}
+
+		var buf bytes.Buffer
+		recorded := collect(stream.Record(stream.Slice(words), &buf, codec, nil))
+		replayed := collect(stream.ReplayPaced(&buf, codec, nil))
+		assert.Equal(t, recorded, replayed)
+		assert.Len(t, replayed, 2)
+	})
+
+	t.Run("decoding errors reach MapReduce", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Replay(strings.NewReader("{\"Key\":1}\nnot json\n"), stream.JSONCodec[stream.Recorded[int, int]]()),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) { return item, nil },
+			func(_ context.Context, acc int, _ stream.Item[int, int]) (int, error) { return acc + 1, nil },
+			0,
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "replay error")
+	})
+}
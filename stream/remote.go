@@ -0,0 +1,393 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RemoteWorkerEnv is set, to the socket to serve on, in the environment of the
+// processes started by RemoteWorkers
+const RemoteWorkerEnv = "DATAFLOW_REMOTE_WORKER"
+
+const (
+	defaultRemoteRetries      = 2
+	defaultRemoteStartTimeout = 10 * time.Second
+)
+
+var (
+	ErrWorkerCrashed = errors.New("remote worker crashed")
+	ErrPoolClosed    = errors.New("remote worker pool is closed")
+)
+
+type (
+	// RemoteCall is what a RemoteWorkers pool sends a worker process for every item
+	RemoteCall[K, I any] struct {
+		Item Item[K, I]
+	}
+
+	// RemoteResult is what a worker process sends back for every RemoteCall
+	RemoteResult[K, O any] struct {
+		Item    Item[K, O]
+		Err     string
+		Skipped bool
+	}
+
+	// RemoteCodecs encode the calls and the results exchanged with the
+	// worker processes, both sides have to use the same ones
+	RemoteCodecs[K, I, O any] struct {
+		Call   Codec[RemoteCall[K, I]]
+		Result Codec[RemoteResult[K, O]]
+	}
+
+	// RemoteOptions configures RemoteWorkers
+	RemoteOptions[K, I, O any] struct {
+		// Workers is the number of worker processes
+		Workers int
+		// Command creates the command that starts a worker process, which has to
+		// call ServeRemoteWorker. RemoteWorkerEnv is added to its environment.
+		Command func() *exec.Cmd
+		// Codecs default to gob
+		Codecs RemoteCodecs[K, I, O]
+		// Retries is how many more times an item is tried, on another worker,
+		// when the worker mapping it crashes, 2 when nil and none when 0
+		Retries *int
+		// StartTimeout bounds the time a worker process has to connect, 10s by default
+		StartTimeout time.Duration
+	}
+
+	// RemoteWorkers maps items in worker processes. Map is a mapper for MapReduce,
+	// every worker maps one item at a time, so a MapReduce using it should have a
+	// concurrency of Size. A worker that crashes is replaced by a new process.
+	RemoteWorkers[K comparable, I, O any] struct {
+		opts      RemoteOptions[K, I, O]
+		retries   int
+		dir       string
+		idleCh    chan *remoteWorker[K, I, O]
+		closedCh  chan struct{}
+		closeOnce sync.Once
+
+		mux     sync.Mutex
+		spawned int
+	}
+
+	// remoteWorker is a worker process and its connection,
+	// a worker without a process is started when it is next needed
+	remoteWorker[K comparable, I, O any] struct {
+		cmd    *exec.Cmd
+		exitCh chan struct{}
+		conn   net.Conn
+		enc    Encoder[RemoteCall[K, I]]
+		dec    Decoder[RemoteResult[K, O]]
+	}
+)
+
+// NewRemoteWorkers starts the worker processes and waits for them to connect
+func NewRemoteWorkers[K comparable, I, O any](ctx context.Context, opts RemoteOptions[K, I, O]) (*RemoteWorkers[K, I, O], error) {
+	if opts.Workers <= 0 || opts.Command == nil {
+		return nil, fmt.Errorf("%w: remote workers need a command and at least one worker", ErrInvalidOption)
+	}
+
+	retries := defaultRemoteRetries
+	if opts.Retries != nil {
+		if *opts.Retries < 0 {
+			return nil, fmt.Errorf("%w: remote workers cannot retry %d times", ErrInvalidOption, *opts.Retries)
+		}
+		retries = *opts.Retries
+	}
+
+	opts.Codecs = opts.Codecs.withDefaults()
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = defaultRemoteStartTimeout
+	}
+
+	dir, err := os.MkdirTemp("", "dataflow-")
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &RemoteWorkers[K, I, O]{
+		opts:     opts,
+		retries:  retries,
+		dir:      dir,
+		idleCh:   make(chan *remoteWorker[K, I, O], opts.Workers),
+		closedCh: make(chan struct{}),
+	}
+
+	var startErr error
+	for i := 0; i < opts.Workers; i++ {
+		w := &remoteWorker[K, I, O]{}
+		if startErr == nil {
+			startErr = rw.start(ctx, w)
+		}
+		rw.idleCh <- w
+	}
+
+	if startErr != nil {
+		rw.Close()
+		return nil, startErr
+	}
+
+	return rw, nil
+}
+
+// Size is the number of worker processes
+func (rw *RemoteWorkers[K, I, O]) Size() int {
+	return rw.opts.Workers
+}
+
+// Map maps the item in the first worker process that is free. Mapper errors
+// come back as plain errors with the same message, except for ErrSkip.
+func (rw *RemoteWorkers[K, I, O]) Map(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+	var crashes []error
+	for attempt := 0; attempt <= rw.retries; attempt++ {
+		var w *remoteWorker[K, I, O]
+		select {
+		case w = <-rw.idleCh:
+		case <-rw.closedCh:
+			return Zero[Item[K, O]](), ErrPoolClosed
+		case <-ctx.Done():
+			return Zero[Item[K, O]](), ctx.Err()
+		}
+
+		result, err := rw.call(ctx, w, item)
+		rw.idleCh <- w
+
+		var crash *workerCrash
+		if !errors.As(err, &crash) {
+			return result, err
+		}
+
+		if ctx.Err() != nil {
+			return Zero[Item[K, O]](), ctx.Err()
+		}
+		crashes = append(crashes, crash.err)
+	}
+
+	return Zero[Item[K, O]](), fmt.Errorf("%w %d times, last: %v", ErrWorkerCrashed, len(crashes), crashes[len(crashes)-1])
+}
+
+// Close stops the worker processes once they are done with the items they
+// are mapping, asking them to exit by closing their connection first and
+// killing the ones that do not within a second
+func (rw *RemoteWorkers[K, I, O]) Close() error {
+	var err error
+	rw.closeOnce.Do(func() {
+		close(rw.closedCh)
+		for i := 0; i < rw.opts.Workers; i++ {
+			w := <-rw.idleCh
+			w.stop(time.Second)
+		}
+		err = os.RemoveAll(rw.dir)
+	})
+	return err
+}
+
+// workerCrash is a failure of the worker rather than of the mapper
+type workerCrash struct {
+	err error
+}
+
+func (c *workerCrash) Error() string {
+	return c.err.Error()
+}
+
+// call maps item in w, starting its process first if it has none, a worker
+// that fails or is interrupted in the middle of a call is stopped, as its
+// connection can no longer be trusted
+func (rw *RemoteWorkers[K, I, O]) call(ctx context.Context, w *remoteWorker[K, I, O], item Item[K, I]) (Item[K, O], error) {
+	if w.conn == nil {
+		if err := rw.start(ctx, w); err != nil {
+			return Zero[Item[K, O]](), err
+		}
+	}
+
+	// a deadline in the past interrupts the call when ctx is done, the
+	// watcher is gone by the time call returns, so it cannot cut the next one
+	w.conn.SetDeadline(time.Time{})
+	doneCh, exitedCh := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(doneCh)
+		<-exitedCh
+	}()
+	go func() {
+		defer close(exitedCh)
+		select {
+		case <-ctx.Done():
+			w.conn.SetDeadline(time.Now())
+		case <-doneCh:
+		}
+	}()
+
+	err := w.enc.Encode(RemoteCall[K, I]{Item: item})
+	var result RemoteResult[K, O]
+	if err == nil {
+		result, err = w.dec.Decode()
+	}
+
+	if err != nil {
+		w.stop(0)
+		if ctx.Err() != nil {
+			return Zero[Item[K, O]](), ctx.Err()
+		}
+		return Zero[Item[K, O]](), &workerCrash{err: err}
+	}
+
+	switch {
+	case result.Skipped:
+		return Zero[Item[K, O]](), ErrSkip
+	case result.Err != "":
+		return Zero[Item[K, O]](), errors.New(result.Err)
+	default:
+		return result.Item, nil
+	}
+}
+
+// start runs a new worker process for w and waits for it to connect
+func (rw *RemoteWorkers[K, I, O]) start(ctx context.Context, w *remoteWorker[K, I, O]) error {
+	select {
+	case <-rw.closedCh:
+		return ErrPoolClosed
+	default:
+	}
+
+	rw.mux.Lock()
+	rw.spawned++
+	path := filepath.Join(rw.dir, fmt.Sprintf("%d.sock", rw.spawned))
+	rw.mux.Unlock()
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	cmd := rw.opts.Command()
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, RemoteWorkerEnv+"="+path)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("remote worker start error: %w", err)
+	}
+
+	exitCh := make(chan struct{})
+	go func() {
+		defer close(exitCh)
+		cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(rw.opts.StartTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	l.SetDeadline(deadline)
+
+	// a process that exits before connecting does not keep us waiting
+	acceptedCh := make(chan struct{})
+	go func() {
+		select {
+		case <-exitCh:
+			l.Close()
+		case <-acceptedCh:
+		}
+	}()
+
+	conn, err := l.Accept()
+	close(acceptedCh)
+	if err != nil {
+		cmd.Process.Kill()
+		<-exitCh
+		return fmt.Errorf("remote worker did not connect: %w", err)
+	}
+
+	w.cmd, w.exitCh, w.conn = cmd, exitCh, conn
+	w.enc = rw.opts.Codecs.Call.NewEncoder(conn)
+	w.dec = rw.opts.Codecs.Result.NewDecoder(conn)
+	return nil
+}
+
+// stop closes the connection of the worker and kills its process if it
+// does not exit within grace, leaving the worker to be started again
+func (w *remoteWorker[K, I, O]) stop(grace time.Duration) {
+	if w.conn == nil {
+		return
+	}
+
+	w.conn.Close()
+	select {
+	case <-w.exitCh:
+	case <-time.After(grace):
+		w.cmd.Process.Kill()
+		<-w.exitCh
+	}
+
+	w.cmd, w.exitCh, w.conn, w.enc, w.dec = nil, nil, nil, nil, nil
+}
+
+// IsRemoteWorker tells whether the process was started by RemoteWorkers
+func IsRemoteWorker() bool {
+	return os.Getenv(RemoteWorkerEnv) != ""
+}
+
+// ServeRemoteWorker connects to the RemoteWorkers pool that started the process
+// and maps the items it sends with mapper until the pool closes the connection.
+// Panics are reported to the pool like errors are, so they do not take the process down.
+func ServeRemoteWorker[K comparable, I, O any](ctx context.Context, m mapper[K, I, O], codecs RemoteCodecs[K, I, O]) error {
+	path := os.Getenv(RemoteWorkerEnv)
+	if path == "" {
+		return fmt.Errorf("%s is not set, the process was not started by RemoteWorkers", RemoteWorkerEnv)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	codecs = codecs.withDefaults()
+	dec := codecs.Call.NewDecoder(conn)
+	enc := codecs.Result.NewEncoder(conn)
+	for {
+		call, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var result RemoteResult[K, O]
+		item, err := safeMap(ctx, m, call.Item)
+		switch {
+		case errors.Is(err, ErrSkip):
+			result.Skipped = true
+		case err != nil:
+			result.Err = err.Error()
+		default:
+			result.Item = item
+		}
+
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+}
+
+func (c RemoteCodecs[K, I, O]) withDefaults() RemoteCodecs[K, I, O] {
+	if c.Call == nil {
+		c.Call = GobCodec[RemoteCall[K, I]]()
+	}
+	if c.Result == nil {
+		c.Result = GobCodec[RemoteResult[K, O]]()
+	}
+	return c
+}
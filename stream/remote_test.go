@@ -0,0 +1,149 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain turns the test binary into a remote worker when RemoteWorkers starts it
+func TestMain(m *testing.M) {
+	if stream.IsRemoteWorker() {
+		if err := stream.ServeRemoteWorker(context.Background(), remoteMapper, stream.RemoteCodecs[int, string, string]{}); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// remoteMapper upper cases values, "crash" takes the worker down, "crash-once:<path>"
+// does so unless the file at path exists, which it creates
+func remoteMapper(_ context.Context, item stream.Item[int, string]) (stream.Item[int, string], error) {
+	switch v := item.Value; {
+	case v == "crash":
+		os.Exit(3)
+	case strings.HasPrefix(v, "crash-once:"):
+		f, err := os.OpenFile(strings.TrimPrefix(v, "crash-once:"), os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			f.Close()
+			os.Exit(3)
+		}
+		return stream.Item[int, string]{Key: item.Key, Value: "SURVIVED"}, nil
+	case v == "fail":
+		return item, errors.New("cannot map fail")
+	case v == "skip":
+		return item, stream.ErrSkip
+	case v == "panic":
+		panic("mapper panicked")
+	}
+
+	return stream.Item[int, string]{Key: item.Key, Value: strings.ToUpper(item.Value)}, nil
+}
+
+func Test_RemoteWorkers(t *testing.T) {
+	testBinary := func() *exec.Cmd { return exec.Command(os.Args[0]) }
+	collectValues := func(_ context.Context, acc []string, item stream.Item[int, string]) ([]string, error) {
+		return append(acc, item.Value), nil
+	}
+
+	assertNoLeaks(t, func() {
+		pool, err := stream.NewRemoteWorkers(context.Background(), stream.RemoteOptions[int, string, string]{
+			Workers: 2,
+			Command: testBinary,
+		})
+		require.NoError(t, err)
+		defer pool.Close()
+
+		t.Run("items are mapped by the workers", func(t *testing.T) {
+			result, err := stream.MapReduce(
+				context.TODO(),
+				stream.Slice([]string{"a", "b", "c", "d", "skip", "e"}),
+				pool.Map,
+				collectValues,
+				nil,
+				stream.WithConcurrency(pool.Size()),
+			)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"A", "B", "C", "D", "E"}, result)
+		})
+
+		t.Run("a crashed item is retried on another worker", func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "crashed")
+			result, err := stream.MapReduce(
+				context.TODO(),
+				stream.Slice([]string{"a", "crash-once:" + marker, "b"}),
+				pool.Map,
+				collectValues,
+				nil,
+				stream.WithConcurrency(pool.Size()),
+			)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"A", "SURVIVED", "B"}, result)
+			assert.FileExists(t, marker)
+		})
+
+		t.Run("items that keep crashing workers fail", func(t *testing.T) {
+			_, err := pool.Map(context.Background(), stream.Item[int, string]{Value: "crash"})
+			assert.True(t, errors.Is(err, stream.ErrWorkerCrashed))
+			assert.Contains(t, err.Error(), "3 times")
+
+			// the crashed workers have been replaced
+			item, err := pool.Map(context.Background(), stream.Item[int, string]{Value: "still there"})
+			require.NoError(t, err)
+			assert.Equal(t, "STILL THERE", item.Value)
+		})
+
+		t.Run("mapper errors and panics", func(t *testing.T) {
+			_, err := pool.Map(context.Background(), stream.Item[int, string]{Value: "fail"})
+			assert.EqualError(t, err, "cannot map fail")
+
+			_, err = pool.Map(context.Background(), stream.Item[int, string]{Value: "panic"})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "mapper panicked")
+		})
+
+		require.NoError(t, pool.Close())
+		_, err = pool.Map(context.Background(), stream.Item[int, string]{Value: "a"})
+		assert.True(t, errors.Is(err, stream.ErrPoolClosed))
+	})
+
+	t.Run("retries can be turned off", func(t *testing.T) {
+		assertNoLeaks(t, func() {
+			noRetries := 0
+			pool, err := stream.NewRemoteWorkers(context.Background(), stream.RemoteOptions[int, string, string]{
+				Workers: 1,
+				Command: testBinary,
+				Retries: &noRetries,
+			})
+			require.NoError(t, err)
+			defer pool.Close()
+
+			_, err = pool.Map(context.Background(), stream.Item[int, string]{Value: "crash"})
+			assert.True(t, errors.Is(err, stream.ErrWorkerCrashed))
+			assert.Contains(t, err.Error(), "1 times")
+		})
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := stream.NewRemoteWorkers(context.Background(), stream.RemoteOptions[int, string, string]{Workers: 1})
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+
+		negative := -1
+		_, err = stream.NewRemoteWorkers(context.Background(), stream.RemoteOptions[int, string, string]{
+			Workers: 1,
+			Command: testBinary,
+			Retries: &negative,
+		})
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+	})
+}
@@ -0,0 +1,53 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type retrying struct {
+	retries int
+	backoff time.Duration
+}
+
+// WithRetries calls the mapper up to n more times for an item it fails to map,
+// waiting backoff before the first retry and twice as long before every one
+// after it. Skipped items are not retried, neither are panics, which end the run,
+// nor the items of a run that is over.
+func WithRetries(n int, backoff time.Duration) reducerOption {
+	return func(fc *flowControl) {
+		if n > 0 {
+			fc.retrying = &retrying{retries: n, backoff: backoff}
+		}
+	}
+}
+
+func retryMapper[K comparable, I, O any](fc *flowControl, m mapper[K, I, O]) mapper[K, I, O] {
+	if fc.retrying == nil {
+		return m
+	}
+
+	retries, backoff := fc.retrying.retries, fc.retrying.backoff
+	return func(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+		wait := backoff
+		for attempt := 0; ; attempt++ {
+			result, err := safeMap(ctx, m, item)
+			var pErr *PanicError
+			if err == nil || errors.Is(err, ErrSkip) || errors.As(err, &pErr) || attempt >= retries || ctx.Err() != nil {
+				return result, err
+			}
+
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return result, err
+				}
+				wait *= 2
+			}
+		}
+	}
+}
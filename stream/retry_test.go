@@ -0,0 +1,94 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyMapper fails the first failures calls for every item
+func flakyMapper(failures int) func(context.Context, stream.Item[int, int]) (stream.Item[int, int], error) {
+	var mux sync.Mutex
+	calls := make(map[int]int)
+	return func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+		mux.Lock()
+		defer mux.Unlock()
+		calls[item.Key]++
+		if calls[item.Key] <= failures {
+			return item, errors.New("flaky")
+		}
+		return item, nil
+	}
+}
+
+func Test_Retries(t *testing.T) {
+	sum := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+		return acc + item.Value, nil
+	}
+
+	t.Run("failed items are retried", func(t *testing.T) {
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3}),
+			flakyMapper(2),
+			sum,
+			0,
+			stream.WithRetries(2, time.Millisecond),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 6, result)
+	})
+
+	t.Run("until the retries run out", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3}),
+			flakyMapper(3),
+			sum,
+			0,
+			stream.WithRetries(2, 0),
+		)
+		assert.ErrorContains(t, err, "flaky")
+	})
+
+	t.Run("skipped items are not retried", func(t *testing.T) {
+		calls := 0
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1}),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+				calls++
+				return item, stream.ErrSkip
+			},
+			sum,
+			0,
+			stream.WithRetries(2, 0),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("panics are not retried", func(t *testing.T) {
+		calls := 0
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1}),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+				calls++
+				panic("bug")
+			},
+			sum,
+			0,
+			stream.WithRetries(2, 0),
+			stream.ErrorThreshold(5),
+		)
+		var pErr *stream.PanicError
+		require.True(t, errors.As(err, &pErr))
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,125 @@
+package superstream
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// sampled is an item kept by a reservoir along with its position in the source
+type sampled[K, V any] struct {
+	seq  int
+	item Item[K, V]
+}
+
+// SampleFraction keeps every item of the iterable with probability p.
+// The same seed keeps the same items of the same sequence of items.
+func SampleFraction[K, V any](iterable Iterable[K, V], p float64, seed int64) Iterable[K, V] {
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		rnd := rand.New(rand.NewSource(seed))
+		for item := range inCh {
+			if rnd.Float64() < p && !emit(item) {
+				return
+			}
+		}
+	})
+}
+
+// Reservoir keeps a uniform sample of k items of a source of unknown length.
+// The sample is emitted once the source is exhausted, in the order the items
+// arrived in. The same seed picks the same items of the same sequence of items.
+// A k below 1 keeps nothing.
+func Reservoir[K, V any](iterable Iterable[K, V], k int, seed int64) Iterable[K, V] {
+	if k < 0 {
+		k = 0
+	}
+
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		rnd := rand.New(rand.NewSource(seed))
+		// the reservoir grows as items arrive, k may well exceed the source
+		var r []sampled[K, V]
+
+		seq := 0
+		for item := range inCh {
+			sampleInto(rnd, &r, k, seq, item)
+			seq++
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		emitSampled(r, emit)
+	})
+}
+
+// StratifiedByKey keeps a uniform sample of up to k items for every key,
+// so that rare keys are as well represented as frequent ones. The samples
+// are emitted once the source is exhausted, in the order the items arrived in.
+// A k below 1 keeps nothing.
+func StratifiedByKey[K comparable, V any](iterable Iterable[K, V], k int, seed int64) Iterable[K, V] {
+	if k < 0 {
+		k = 0
+	}
+
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		rnd := rand.New(rand.NewSource(seed))
+		strata := make(map[K]*[]sampled[K, V])
+		seen := make(map[K]int)
+
+		seq := 0
+		for item := range inCh {
+			r, ok := strata[item.Key]
+			if !ok {
+				r = &[]sampled[K, V]{}
+				strata[item.Key] = r
+			}
+
+			// every stratum is a reservoir on its own, the sequence of the item
+			// within its stratum decides whether it gets in
+			sampleIntoAt(rnd, r, k, seen[item.Key], seq, item)
+			seen[item.Key]++
+			seq++
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		var all []sampled[K, V]
+		for _, r := range strata {
+			all = append(all, *r...)
+		}
+
+		emitSampled(all, emit)
+	})
+}
+
+func sampleInto[K, V any](rnd *rand.Rand, r *[]sampled[K, V], k, seq int, item Item[K, V]) {
+	sampleIntoAt(rnd, r, k, seq, seq, item)
+}
+
+// sampleIntoAt is the step of Algorithm R for the n-th item of a reservoir
+func sampleIntoAt[K, V any](rnd *rand.Rand, r *[]sampled[K, V], k, n, seq int, item Item[K, V]) {
+	if k <= 0 {
+		return
+	}
+
+	if n < k {
+		*r = append(*r, sampled[K, V]{seq: seq, item: item})
+		return
+	}
+
+	if j := rnd.Intn(n + 1); j < k {
+		(*r)[j] = sampled[K, V]{seq: seq, item: item}
+	}
+}
+
+func emitSampled[K, V any](r []sampled[K, V], emit func(Item[K, V]) bool) {
+	sort.Slice(r, func(i, j int) bool { return r[i].seq < r[j].seq })
+	for _, s := range r {
+		if !emit(s.item) {
+			return
+		}
+	}
+}
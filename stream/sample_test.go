@@ -0,0 +1,139 @@
+package superstream_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect[K, V any](iterable stream.Iterable[K, V]) []stream.Item[K, V] {
+	var items []stream.Item[K, V]
+	for item := range iterable(context.Background()) {
+		items = append(items, item)
+	}
+	return items
+}
+
+func keys[K, V any](items []stream.Item[K, V]) []K {
+	result := make([]K, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.Key)
+	}
+	return result
+}
+
+func Test_Sampling(t *testing.T) {
+	const n = 100_000
+
+	in := make([]int, n)
+	for i := range in {
+		in[i] = i
+	}
+
+	t.Run("fraction", func(t *testing.T) {
+		sample := collect(stream.SampleFraction(stream.Slice(in), 0.1, 42))
+		assert.InDelta(t, n/10, len(sample), n/100)
+
+		again := collect(stream.SampleFraction(stream.Slice(in), 0.1, 42))
+		assert.Equal(t, sample, again)
+
+		other := collect(stream.SampleFraction(stream.Slice(in), 0.1, 7))
+		assert.NotEqual(t, sample, other)
+
+		assert.Empty(t, collect(stream.SampleFraction(stream.Slice(in), 0, 42)))
+		assert.Len(t, collect(stream.SampleFraction(stream.Slice(in), 1, 42)), n)
+	})
+
+	t.Run("reservoir", func(t *testing.T) {
+		sample := collect(stream.Reservoir(stream.Slice(in), 100, 42))
+		require.Len(t, sample, 100)
+		assert.Equal(t, sample, collect(stream.Reservoir(stream.Slice(in), 100, 42)))
+
+		for i := 1; i < len(sample); i++ {
+			assert.True(t, sample[i-1].Key < sample[i].Key, "expected items in arrival order")
+		}
+
+		assert.Equal(t, []int{0, 1, 2}, keys(collect(stream.Reservoir(stream.Slice([]int{0, 1, 2}), 5, 42))))
+		assert.Equal(t, []int{0, 1, 2}, keys(collect(stream.Reservoir(stream.Slice([]int{0, 1, 2}), math.MaxInt, 42))))
+		assert.Empty(t, collect(stream.Reservoir(stream.Slice(in), -1, 42)))
+		assert.Empty(t, collect(stream.StratifiedByKey(stream.Slice(in), -1, 42)))
+	})
+
+	t.Run("reservoir is uniform", func(t *testing.T) {
+		const runs = 4000
+		counts := make([]int, 10)
+		for seed := int64(0); seed < runs; seed++ {
+			for _, item := range collect(stream.Reservoir(stream.Slice(in[:10]), 3, seed)) {
+				counts[item.Key]++
+			}
+		}
+
+		expected := float64(runs) * 3 / 10
+		for i, c := range counts {
+			assert.True(t, math.Abs(float64(c)-expected) < expected*0.1, "item %d picked %d times", i, c)
+		}
+	})
+
+	t.Run("stratified by key", func(t *testing.T) {
+		events := make(map[string]int)
+		var items []stream.Item[string, int]
+		for i := 0; i < 1000; i++ {
+			key := "frequent"
+			switch {
+			case i%100 == 0:
+				key = "rare"
+			case i%10 == 0:
+				key = "common"
+			}
+			items = append(items, stream.Item[string, int]{Key: key, Value: i})
+		}
+
+		source := func(ctx context.Context) <-chan stream.Item[string, int] {
+			resultCh := make(chan stream.Item[string, int])
+			go func() {
+				defer close(resultCh)
+				for _, item := range items {
+					select {
+					case resultCh <- item:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return resultCh
+		}
+
+		sample := collect(stream.StratifiedByKey[string, int](source, 20, 42))
+		for _, item := range sample {
+			events[item.Key]++
+		}
+
+		assert.Equal(t, map[string]int{"frequent": 20, "common": 20, "rare": 10}, events)
+		assert.Equal(t, sample, collect(stream.StratifiedByKey[string, int](source, 20, 42)))
+
+		for i := 1; i < len(sample); i++ {
+			assert.True(t, sample[i-1].Value < sample[i].Value, "expected items in arrival order")
+		}
+	})
+
+	t.Run("sampled sources feed map reduce", func(t *testing.T) {
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Reservoir(stream.Slice(in), 10, 42),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+				return item, nil
+			},
+			func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+				return acc + 1, nil
+			},
+			0,
+			stream.WithConcurrency(4),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 10, result)
+	})
+}
@@ -0,0 +1,107 @@
+package superstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultSnapshotInterval = time.Second
+
+type (
+	// Cloner is implemented by accumulators that hold references, maps or slices for
+	// instance, and know how to copy themselves, so that a snapshot can be handed
+	// out while the reduction goes on
+	Cloner[R any] interface {
+		Clone() R
+	}
+
+	accSnapshots struct {
+		// publish is a func(R)
+		publish  any
+		interval time.Duration
+	}
+)
+
+// Scan reduces the items of the iterable like MapReduce does, but emits the
+// running accumulator after every n items instead of only at the end, keyed by
+// the number of items reduced so far. Whatever was reduced after the last emission
+// is emitted once the source is exhausted. A reducer error ends the stream and is
+// returned by the running MapReduce. The accumulator is emitted as is, an
+// accumulator that is a Cloner is cloned first.
+func Scan[K, V, R any](
+	iterable Iterable[K, V],
+	reducer func(context.Context, R, Item[K, V]) (R, error),
+	init R,
+	n int,
+) Iterable[int, R] {
+	if n < 1 {
+		n = 1
+	}
+
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[int, R]) bool) {
+		acc := init
+		count, emitted := 0, 0
+
+		for item := range inCh {
+			var err error
+			acc, err = reducer(ctx, acc, item)
+			if err != nil {
+				reportSourceError(ctx, fmt.Errorf("scan error: %w", err))
+				return
+			}
+
+			count++
+			if count-emitted < n {
+				continue
+			}
+
+			emitted = count
+			if !emit(Item[int, R]{Key: count, Value: snapshotOf(acc)}) {
+				return
+			}
+		}
+
+		if ctx.Err() == nil && count > emitted {
+			emit(Item[int, R]{Key: count, Value: snapshotOf(acc)})
+		}
+	})
+}
+
+// WithSnapshots calls publish with a copy of the accumulator every interval
+// while MapReduce runs, and once more with the final one just before it returns,
+// which makes long running and unbounded reductions observable. Publish has to
+// accept the accumulator type and runs between two reductions, so it always sees
+// a consistent accumulator, but it holds the reduction up until it returns.
+// An accumulator that is a Cloner is cloned for publish, any other is copied by value.
+func WithSnapshots[R any](interval time.Duration, publish func(R)) reducerOption {
+	return func(fc *flowControl) {
+		if interval <= 0 {
+			interval = defaultSnapshotInterval
+		}
+
+		fc.snapshots = &accSnapshots{publish: publish, interval: interval}
+	}
+}
+
+// snapshotPublisher is the publish func of WithSnapshots, nil when there is none
+func snapshotPublisher[R any](fc *flowControl) (func(R), error) {
+	if fc.snapshots == nil {
+		return nil, nil
+	}
+
+	publish, ok := fc.snapshots.publish.(func(R))
+	if !ok || publish == nil {
+		return nil, fmt.Errorf("%w: WithSnapshots expects a %T, got a %T", ErrInvalidOption, publish, fc.snapshots.publish)
+	}
+
+	return func(acc R) { publish(snapshotOf(acc)) }, nil
+}
+
+func snapshotOf[R any](acc R) R {
+	if c, ok := any(acc).(Cloner[R]); ok {
+		return c.Clone()
+	}
+
+	return acc
+}
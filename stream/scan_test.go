@@ -0,0 +1,141 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tally counts words, it clones itself for snapshots
+type tally map[string]int
+
+func (t tally) Clone() tally {
+	c := make(tally, len(t))
+	for k, v := range t {
+		c[k] = v
+	}
+	return c
+}
+
+func Test_Scan(t *testing.T) {
+	sum := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+		return acc + item.Value, nil
+	}
+
+	t.Run("running accumulator every n items", func(t *testing.T) {
+		items := collect(stream.Scan(stream.Slice([]int{1, 2, 3, 4, 5}), sum, 0, 2))
+
+		assert.Equal(t, []stream.Item[int, int]{
+			{Key: 2, Value: 3},
+			{Key: 4, Value: 10},
+			{Key: 5, Value: 15},
+		}, items)
+	})
+
+	t.Run("after every item", func(t *testing.T) {
+		items := collect(stream.Scan(stream.Slice([]int{1, 2, 3}), sum, 0, 1))
+		assert.Equal(t, []int{1, 2, 3}, keys(items))
+		assert.Equal(t, 6, items[2].Value)
+	})
+
+	t.Run("cloners are cloned", func(t *testing.T) {
+		count := func(_ context.Context, acc tally, item stream.Item[int, string]) (tally, error) {
+			acc[item.Value]++
+			return acc, nil
+		}
+
+		items := collect(stream.Scan(stream.Slice([]string{"a", "b", "a"}), count, tally{}, 1))
+		require.Len(t, items, 3)
+		assert.Equal(t, tally{"a": 1}, items[0].Value)
+		assert.Equal(t, tally{"a": 1, "b": 1}, items[1].Value)
+		assert.Equal(t, tally{"a": 2, "b": 1}, items[2].Value)
+	})
+
+	t.Run("reducer errors end the stream", func(t *testing.T) {
+		errOdd := errors.New("odd")
+		failing := func(_ context.Context, acc int, item stream.Item[int, int]) (int, error) {
+			if item.Value == 3 {
+				return acc, errOdd
+			}
+			return acc + item.Value, nil
+		}
+
+		last, err := stream.MapReduce(
+			context.TODO(),
+			stream.Scan(stream.Slice([]int{1, 2, 3, 4}), failing, 0, 1),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) { return item, nil },
+			func(_ context.Context, _ int, item stream.Item[int, int]) (int, error) { return item.Value, nil },
+			0,
+		)
+		assert.True(t, errors.Is(err, errOdd))
+		assert.Equal(t, 3, last)
+	})
+}
+
+func Test_Snapshots(t *testing.T) {
+	count := func(_ context.Context, acc tally, item stream.Item[int, string]) (tally, error) {
+		acc[item.Value]++
+		return acc, nil
+	}
+
+	t.Run("published while running and at the end", func(t *testing.T) {
+		in := make([]string, 50)
+		for i := range in {
+			in[i] = "ab"[i%2 : i%2+1]
+		}
+
+		var mux sync.Mutex
+		var snapshots []tally
+
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			func(_ context.Context, item stream.Item[int, string]) (stream.Item[int, string], error) {
+				time.Sleep(time.Millisecond)
+				return item, nil
+			},
+			count,
+			tally{},
+			stream.WithChunkSize(1),
+			stream.WithSnapshots(5*time.Millisecond, func(acc tally) {
+				mux.Lock()
+				defer mux.Unlock()
+				snapshots = append(snapshots, acc)
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, tally{"a": 25, "b": 25}, result)
+
+		mux.Lock()
+		defer mux.Unlock()
+		require.Greater(t, len(snapshots), 1)
+		assert.Equal(t, result, snapshots[len(snapshots)-1])
+
+		// every snapshot is a copy, so they only ever grow
+		for i := 1; i < len(snapshots); i++ {
+			prev, cur := snapshots[i-1], snapshots[i]
+			assert.LessOrEqual(t, prev["a"]+prev["b"], cur["a"]+cur["b"])
+		}
+		assert.Less(t, snapshots[0]["a"]+snapshots[0]["b"], 50)
+	})
+
+	t.Run("invalid publish", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]string{"a"}),
+			func(_ context.Context, item stream.Item[int, string]) (stream.Item[int, string], error) {
+				return item, nil
+			},
+			count,
+			tally{},
+			stream.WithSnapshots(time.Millisecond, func(int) {}),
+		)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+	})
+}
@@ -0,0 +1,143 @@
+package superstream
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/denismitr/dataflow/orderedmap"
+	"github.com/denismitr/dataflow/queue"
+	"github.com/denismitr/dataflow/set"
+)
+
+type (
+	// Sink is where the results of a stream end up. Write is never called
+	// concurrently and Close is called exactly once, after the last Write.
+	Sink[K, V any] interface {
+		Write(ctx context.Context, item Item[K, V]) error
+		Close() error
+	}
+
+	chanSink[K, V any] struct {
+		ch chan<- Item[K, V]
+	}
+
+	writerSink[K, V any] struct {
+		buf *bufio.Writer
+		enc Encoder[Item[K, V]]
+	}
+
+	orderedMapSink[K comparable, V any] struct {
+		om *orderedmap.OrderedMap[K, V]
+	}
+
+	hashSetSink[K any, V comparable] struct {
+		s *set.HashSet[V]
+	}
+
+	ringQueueSink[K, V any] struct {
+		q *queue.RingQueue[Item[K, V]]
+	}
+)
+
+// ChanSink forwards items to ch and closes it once the stream is over
+func ChanSink[K, V any](ch chan<- Item[K, V]) Sink[K, V] {
+	return &chanSink[K, V]{ch: ch}
+}
+
+func (s *chanSink[K, V]) Write(ctx context.Context, item Item[K, V]) error {
+	select {
+	case s.ch <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *chanSink[K, V]) Close() error {
+	close(s.ch)
+	return nil
+}
+
+// WriterSink encodes items with the codec and writes them to w.
+// Writes are buffered and flushed on Close, w itself is left open.
+func WriterSink[K, V any](w io.Writer, codec Codec[Item[K, V]]) Sink[K, V] {
+	buf := bufio.NewWriter(w)
+	return &writerSink[K, V]{buf: buf, enc: codec.NewEncoder(buf)}
+}
+
+func (s *writerSink[K, V]) Write(_ context.Context, item Item[K, V]) error {
+	return s.enc.Encode(item)
+}
+
+func (s *writerSink[K, V]) Close() error {
+	return s.buf.Flush()
+}
+
+// OrderedMapSink sets every item in om, in the order items arrive
+func OrderedMapSink[K comparable, V any](om *orderedmap.OrderedMap[K, V]) Sink[K, V] {
+	return &orderedMapSink[K, V]{om: om}
+}
+
+func (s *orderedMapSink[K, V]) Write(_ context.Context, item Item[K, V]) error {
+	s.om.Set(item.Key, item.Value)
+	return nil
+}
+
+func (s *orderedMapSink[K, V]) Close() error {
+	return nil
+}
+
+// HashSetSink inserts the value of every item into s
+func HashSetSink[K any, V comparable](s *set.HashSet[V]) Sink[K, V] {
+	return &hashSetSink[K, V]{s: s}
+}
+
+func (s *hashSetSink[K, V]) Write(_ context.Context, item Item[K, V]) error {
+	s.s.Insert(item.Value)
+	return nil
+}
+
+func (s *hashSetSink[K, V]) Close() error {
+	return nil
+}
+
+// RingQueueSink enqueues every item into q, a full queue is reported as an error
+func RingQueueSink[K, V any](q *queue.RingQueue[Item[K, V]]) Sink[K, V] {
+	return &ringQueueSink[K, V]{q: q}
+}
+
+func (s *ringQueueSink[K, V]) Write(_ context.Context, item Item[K, V]) error {
+	if err := s.q.Enqueue(item); err != nil {
+		return fmt.Errorf("could not enqueue item %v: %w", item.Key, err)
+	}
+	return nil
+}
+
+func (s *ringQueueSink[K, V]) Close() error {
+	return nil
+}
+
+// RunInto maps every item of the iterable and writes the results to the sink.
+// It takes the same options as MapReduce, with errors of the sink counting
+// towards the error threshold the same way errors of a reducer do.
+// The sink is closed once the run is over, whatever its outcome.
+func RunInto[K comparable, I, O any](
+	ctx context.Context,
+	iterable Iterable[K, I],
+	mapper mapper[K, I, O],
+	sink Sink[K, O],
+	options ...reducerOption,
+) error {
+	write := func(ctx context.Context, acc struct{}, item Item[K, O]) (struct{}, error) {
+		return acc, sink.Write(ctx, item)
+	}
+
+	_, err := MapReduce(ctx, iterable, mapper, write, struct{}{}, options...)
+	if closeErr := sink.Close(); closeErr != nil {
+		return appendError(err, fmt.Errorf("sink close error: %w", closeErr))
+	}
+
+	return err
+}
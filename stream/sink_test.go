@@ -0,0 +1,136 @@
+package superstream_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/denismitr/dataflow/orderedmap"
+	"github.com/denismitr/dataflow/queue"
+	"github.com/denismitr/dataflow/set"
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type intStringItem = stream.Item[int, string]
+
+func stringify(_ context.Context, item stream.Item[int, int]) (intStringItem, error) {
+	if item.Value%2 != 0 {
+		return intStringItem{}, stream.ErrSkip
+	}
+	return intStringItem{Key: item.Key, Value: fmt.Sprintf("v%d", item.Value)}, nil
+}
+
+func Test_RunInto(t *testing.T) {
+	in := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	t.Run("channel sink", func(t *testing.T) {
+		ch := make(chan intStringItem)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.ChanSink(ch), stream.WithConcurrency(3))
+		}()
+
+		var values []string
+		for item := range ch {
+			values = append(values, item.Value)
+		}
+
+		require.NoError(t, <-errCh)
+		sort.Strings(values)
+		assert.Equal(t, []string{"v0", "v2", "v4", "v6", "v8"}, values)
+	})
+
+	t.Run("writer sink with json codec", func(t *testing.T) {
+		var buf bytes.Buffer
+		codec := stream.JSONCodec[intStringItem]()
+
+		err := stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.WriterSink(&buf, codec))
+		require.NoError(t, err)
+		assert.Equal(t, 5, strings.Count(buf.String(), "\n"))
+
+		dec := codec.NewDecoder(&buf)
+		var items []intStringItem
+		for {
+			item, err := dec.Decode()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			items = append(items, item)
+		}
+
+		assert.Equal(t, []intStringItem{
+			{Key: 0, Value: "v0"},
+			{Key: 2, Value: "v2"},
+			{Key: 4, Value: "v4"},
+			{Key: 6, Value: "v6"},
+			{Key: 8, Value: "v8"},
+		}, items)
+	})
+
+	t.Run("writer sink with gob codec", func(t *testing.T) {
+		var buf bytes.Buffer
+		codec := stream.GobCodec[intStringItem]()
+
+		err := stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.WriterSink(&buf, codec))
+		require.NoError(t, err)
+
+		dec := codec.NewDecoder(&buf)
+		var count int
+		for {
+			if _, err := dec.Decode(); errors.Is(err, io.EOF) {
+				break
+			} else {
+				require.NoError(t, err)
+			}
+			count++
+		}
+		assert.Equal(t, 5, count)
+	})
+
+	t.Run("ordered map sink", func(t *testing.T) {
+		om := orderedmap.NewOrderedMap[int, string]()
+		err := stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.OrderedMapSink(om))
+		require.NoError(t, err)
+
+		assert.Equal(t, 5, om.Len())
+		assert.Equal(t, "v4", om.Get(4))
+		assert.False(t, om.Has(5))
+	})
+
+	t.Run("hash set sink", func(t *testing.T) {
+		s := set.NewHashSet[string]()
+		err := stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.HashSetSink[int](s), stream.WithConcurrency(4))
+		require.NoError(t, err)
+
+		items := s.Items()
+		sort.Strings(items)
+		assert.Equal(t, []string{"v0", "v2", "v4", "v6", "v8"}, items)
+	})
+
+	t.Run("ring queue sink", func(t *testing.T) {
+		q := queue.NewAtomicRingQueue[intStringItem](8)
+		err := stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.RingQueueSink(q))
+		require.NoError(t, err)
+
+		first, err := q.Dequeue()
+		require.NoError(t, err)
+		assert.Equal(t, intStringItem{Key: 0, Value: "v0"}, first)
+		assert.Equal(t, 4, q.Len())
+	})
+
+	t.Run("ring queue overflow counts towards the error threshold", func(t *testing.T) {
+		q := queue.NewAtomicRingQueue[intStringItem](2)
+		err := stream.RunInto(context.TODO(), stream.Slice(in), stringify, stream.RingQueueSink(q), stream.ErrorThreshold(1))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, queue.ErrOverflow))
+		assert.Equal(t, 2, q.Len())
+	})
+}
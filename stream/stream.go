@@ -4,68 +4,133 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultChunkSize = 64
+	defaultQueueSize = 256
 )
 
 type (
 	flowControl struct {
 		concurrency    int
 		errorThreshold int
+		chunkSize      int
+		progress       progressReporter
+		stats          Stats
+		breaker        *BreakerConfig
+		queueSize      int
+		affinity       *keyAffinity
+		priority       *itemPriority
+		weight         *itemWeight
+		snapshots      *accSnapshots
+		hedging        *hedging
+		tracer         *Tracer
+		commitEvery    int
+		retrying       *retrying
 	}
 
 	reducerOption func(fc *flowControl)
 
 	mapper[K comparable, I, O any] func(context.Context, Item[K, I]) (Item[K, O], error)
 	reducer[K, R, O any]           func(context.Context, R, Item[K, O]) (R, error)
+
+	// mapped is the outcome of mapping a single item, either a result or an error
+	mapped[K comparable, O any] struct {
+		item Item[K, O]
+		err  error
+	}
 )
 
 func doMap[K comparable, I, O any](
 	ctx context.Context,
 	fc *flowControl,
-	inCh <-chan Item[K, I],
+	tasks *sync.WaitGroup,
+	d dispatcher[K, I],
 	mapper mapper[K, I, O],
-) (<-chan Item[K, O], <-chan error) {
-	resultCh := make(chan Item[K, O])
-	errCh := make(chan error)
-	var tasks sync.WaitGroup
+) <-chan []mapped[K, O] {
+	resultCh := make(chan []mapped[K, O])
+	var workers sync.WaitGroup
 
+	tasks.Add(fc.concurrency + 1)
 	for i := 0; i < fc.concurrency; i++ {
-		tasks.Add(1)
-		go func() {
+		workers.Add(1)
+		go func(worker int) {
 			defer tasks.Done()
+			defer workers.Done()
+
+			// the traced mapper learns from the context whose call it is timing
+			workerCtx := ctx
+			if fc.tracer != nil {
+				workerCtx = context.WithValue(ctx, traceWorkerKey{}, worker)
+			}
+
 			for {
-				if err := ctx.Err(); err != nil {
+				chunk, ok := d.next(ctx, worker)
+				if !ok {
 					return
 				}
 
-				select {
-				case item, ok := <-inCh:
-					if !ok {
+				results := make([]mapped[K, O], 0, len(chunk))
+				for _, item := range chunk {
+					if err := ctx.Err(); err != nil {
 						return
 					}
-					result, err := mapper(ctx, item)
+
+					result, err := safeMap(workerCtx, mapper, item)
+
 					if err != nil {
 						if errors.Is(err, ErrSkip) {
+							atomic.AddInt64(&fc.stats.Skipped, 1)
 							continue
 						}
 
-						errCh <- fmt.Errorf("map error: %w", err)
+						results = append(results, mapped[K, O]{err: fmt.Errorf("map error: %w", err)})
 					} else {
-						resultCh <- result
+						results = append(results, mapped[K, O]{item: result})
 					}
+				}
+
+				if len(results) == 0 {
+					continue
+				}
+
+				select {
+				case resultCh <- results:
 				case <-ctx.Done():
 					return
 				}
 			}
-		}()
+		}(i)
 	}
 
 	go func() {
-		tasks.Wait()
+		defer tasks.Done()
+		workers.Wait()
 		close(resultCh)
 	}()
 
-	return resultCh, errCh
+	return resultCh
+}
+
+// safeMap turns a panicking mapper into a *PanicError, so that
+// a single bad item cannot take the whole process down
+func safeMap[K comparable, I, O any](
+	ctx context.Context,
+	mapper mapper[K, I, O],
+	item Item[K, I],
+) (result Item[K, O], err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return mapper(ctx, item)
 }
 
 func ErrorThreshold(et int) reducerOption {
@@ -78,7 +143,30 @@ func ErrorThreshold(et int) reducerOption {
 
 func WithConcurrency(c int) reducerOption {
 	return func(fc *flowControl) {
-		fc.concurrency = c
+		if c > 0 {
+			fc.concurrency = c
+		}
+	}
+}
+
+// WithChunkSize sets the maximum number of items that travel together
+// between the source, the mappers and the reducer. Bigger chunks mean
+// less synchronization per item, a chunk size of 1 moves items one by one.
+func WithChunkSize(n int) reducerOption {
+	return func(fc *flowControl) {
+		if n > 0 {
+			fc.chunkSize = n
+		}
+	}
+}
+
+// WithQueueSize bounds the number of items that can wait for a mapper
+// when MapReduce has to queue them, with WithKeyAffinity or WithPriority
+func WithQueueSize(n int) reducerOption {
+	return func(fc *flowControl) {
+		if n > 0 {
+			fc.queueSize = n
+		}
 	}
 }
 
@@ -90,17 +178,72 @@ func MapReduce[K comparable, I, O, R any](
 	initialReducerValue R,
 	options ...reducerOption,
 ) (R, error) {
-	fc := &flowControl{concurrency: 1, errorThreshold: 1}
+	fc := &flowControl{
+		concurrency:    1,
+		errorThreshold: 1,
+		chunkSize:      defaultChunkSize,
+		progress:       progressReporter{interval: defaultProgressInterval},
+		queueSize:      defaultQueueSize,
+	}
 	for _, opt := range options {
 		opt(fc)
 	}
 
+	started := time.Now()
 	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
+	ctx, hooks := withRunHooks(ctx)
 	inCh := iterable(ctx)
-	outCh, mapErrCh := doMap(ctx, fc, inCh, mapper)
-	acc, err := doReduce(ctx, outCh, mapErrCh, fc, reducer, initialReducerValue)
+
+	total, ok := hooks.size(inCh)
+	if !ok {
+		total = -1
+	}
+
+	// whichever way doReduce returns, even by panicking, nothing started
+	// on behalf of this call is allowed to outlive it
+	var tasks sync.WaitGroup
+	defer func() {
+		cancel()
+		tasks.Wait()
+		drain(inCh)
+		fc.progress.final(&fc.stats, total, started)
+	}()
+
+	fc.progress.run(ctx, &tasks, &fc.stats, total, started)
+
+	mapper = tracedMapper(fc, mapper)
+	mapper = hedgedMapper(fc, &tasks, mapper)
+	mapper = retryMapper(fc, mapper)
+	mapper, err := breakerMapper(fc, mapper)
+	if err != nil {
+		return initialReducerValue, err
+	}
+
+	mapper, err = weightedMapper(fc, mapper)
+	if err != nil {
+		return initialReducerValue, err
+	}
+
+	publish, err := snapshotPublisher[R](fc)
+	if err != nil {
+		return initialReducerValue, err
+	}
+
+	d, err := newDispatcher(ctx, fc, &tasks, inCh)
+	if err != nil {
+		return initialReducerValue, err
+	}
+
+	outCh := doMap(ctx, fc, &tasks, d, mapper)
+	acc, err := doReduce(ctx, outCh, fc, reducer, initialReducerValue, publish)
+	if publish != nil {
+		publish(acc)
+	}
+
+	for _, srcErr := range hooks.sourceErrors() {
+		err = appendError(err, fmt.Errorf("source error: %w", srcErr))
+	}
+
 	if err != nil {
 		return acc, err
 	}
@@ -110,29 +253,59 @@ func MapReduce[K comparable, I, O, R any](
 
 func doReduce[K comparable, R, O any](
 	ctx context.Context,
-	outCh <-chan Item[K, O],
-	mapErrCh <-chan error,
+	outCh <-chan []mapped[K, O],
 	fc *flowControl,
 	r reducer[K, R, O],
 	initialValue R,
+	publish func(R),
 ) (R, error) {
 	acc := initialValue
 	var mpErr MapReduceError = nil
 
-	for {
-		if len(mpErr) >= fc.errorThreshold {
-			return acc, multiErrorOrNil(mpErr)
-		}
+	var snapshotCh <-chan time.Time
+	if publish != nil {
+		ticker := time.NewTicker(fc.snapshots.interval)
+		defer ticker.Stop()
+		snapshotCh = ticker.C
+	}
 
+	for {
 		select {
-		case item, ok := <-outCh:
+		case <-snapshotCh:
+			publish(acc)
+		case results, ok := <-outCh:
 			if !ok {
 				return acc, multiErrorOrNil(nil)
-			} else {
-				var err error
-				acc, err = r(ctx, acc, item)
-				if err != nil {
-					mpErr = append(mpErr, fmt.Errorf("reduce error: %w", err))
+			}
+
+			for _, result := range results {
+				if result.err != nil {
+					mpErr = append(mpErr, result.err)
+					atomic.AddInt64(&fc.stats.Failed, 1)
+				} else {
+					var started time.Time
+					if fc.tracer != nil {
+						started = time.Now()
+					}
+
+					var err error
+					acc, err = r(ctx, acc, result.item)
+					if fc.tracer != nil {
+						fc.tracer.reduceSpan(result.item.Key, started, err)
+					}
+
+					if err != nil {
+						mpErr = append(mpErr, fmt.Errorf("reduce error: %w", err))
+						atomic.AddInt64(&fc.stats.Failed, 1)
+					} else {
+						atomic.AddInt64(&fc.stats.Processed, 1)
+					}
+				}
+
+				// a panic is a bug rather than a bad item, so it ends the run whatever the threshold
+				var pErr *PanicError
+				if len(mpErr) >= fc.errorThreshold || (result.err != nil && errors.As(result.err, &pErr)) {
+					return acc, multiErrorOrNil(mpErr)
 				}
 			}
 		case <-ctx.Done():
@@ -142,12 +315,17 @@ func doReduce[K comparable, R, O any](
 			} else {
 				return acc, append(mpErr, ctx.Err())
 			}
-		case err := <-mapErrCh:
-			mpErr = append(mpErr, err)
 		}
 	}
 }
 
+// drain unblocks a source that is still trying to send and waits for it
+// to close its channel, which it must do once its context is done
+func drain[K, V any](inCh <-chan Item[K, V]) {
+	for range inCh {
+	}
+}
+
 func multiErrorOrNil(mpErr MapReduceError) error {
 	if len(mpErr) == 0 {
 		return nil
@@ -0,0 +1,178 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+)
+
+const benchItems = 1_000_000
+
+type benchItem = stream.Item[int, int]
+
+func benchMapper(_ context.Context, item benchItem) (benchItem, error) {
+	return benchItem{Key: item.Key, Value: item.Value * 2}, nil
+}
+
+func benchReducer(_ context.Context, acc int, item benchItem) (int, error) {
+	return acc + item.Value, nil
+}
+
+func benchInput() []int {
+	in := make([]int, benchItems)
+	for i := range in {
+		in[i] = i
+	}
+	return in
+}
+
+// channelSource is an Iterable the stream package knows nothing about
+func channelSource(items []int) stream.Iterable[int, int] {
+	return func(ctx context.Context) <-chan benchItem {
+		resultCh := make(chan benchItem)
+		go func() {
+			defer close(resultCh)
+			for i, v := range items {
+				select {
+				case <-ctx.Done():
+					return
+				case resultCh <- benchItem{Key: i, Value: v}:
+				}
+			}
+		}()
+		return resultCh
+	}
+}
+
+func BenchmarkMapReduce(b *testing.B) {
+	in := benchInput()
+
+	b.Run("per item baseline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := perItemMapReduce(context.Background(), stream.Slice(in), 8); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("parallel slice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := stream.MapReduce(
+				context.Background(),
+				stream.ParallelSlice(in),
+				benchMapper,
+				benchReducer,
+				0,
+				stream.WithConcurrency(8),
+			)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, size := range []int{1, 16, 64, 256, 1024} {
+		size := size
+		b.Run(fmt.Sprintf("slice chunk size %d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := stream.MapReduce(
+					context.Background(),
+					stream.Slice(in),
+					benchMapper,
+					benchReducer,
+					0,
+					stream.WithConcurrency(8),
+					stream.WithChunkSize(size),
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("channel chunk size %d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := stream.MapReduce(
+					context.Background(),
+					channelSource(in),
+					benchMapper,
+					benchReducer,
+					0,
+					stream.WithConcurrency(8),
+					stream.WithChunkSize(size),
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// perItemMapReduce reproduces the pipeline as it was before chunking was
+// introduced: every item costs a channel operation on the way to a mapper,
+// another one on the way to the reducer and a select on each side.
+func perItemMapReduce(ctx context.Context, iterable stream.Iterable[int, int], concurrency int) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inCh := iterable(ctx)
+	resultCh := make(chan benchItem)
+	errCh := make(chan error)
+
+	var tasks sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		tasks.Add(1)
+		go func() {
+			defer tasks.Done()
+			for {
+				select {
+				case item, ok := <-inCh:
+					if !ok {
+						return
+					}
+					result, err := benchMapper(ctx, item)
+					if err != nil {
+						select {
+						case errCh <- err:
+						case <-ctx.Done():
+							return
+						}
+						continue
+					}
+					select {
+					case resultCh <- result:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		tasks.Wait()
+		close(resultCh)
+	}()
+
+	var acc int
+	for {
+		select {
+		case item, ok := <-resultCh:
+			if !ok {
+				return acc, nil
+			}
+			acc, _ = benchReducer(ctx, acc, item)
+		case err := <-errCh:
+			return acc, err
+		case <-ctx.Done():
+			return acc, errors.New("cancelled")
+		}
+	}
+}
@@ -197,7 +197,109 @@ func Test_MapReduce(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("chunk sizes do not change the result", func(t *testing.T) {
+		type intSliceItem = stream.Item[int, int]
+
+		const n = 10_000
+		in := make([]int, 0, n)
+		var sumExp int
+		for i := 0; i < n; i++ {
+			in = append(in, i)
+			sumExp += i * 3
+		}
+
+		// evenOnly wraps Slice, so MapReduce must not read Slice directly
+		evenOnly := func(ctx context.Context) <-chan intSliceItem {
+			resultCh := make(chan intSliceItem)
+			go func() {
+				defer close(resultCh)
+				for item := range stream.Slice(in)(ctx) {
+					if item.Key%2 != 0 {
+						continue
+					}
+					select {
+					case resultCh <- item:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return resultCh
+		}
+
+		var evenSumExp int
+		for i := 0; i < n; i += 2 {
+			evenSumExp += i * 3
+		}
+
+		mapper := func(_ context.Context, item intSliceItem) (intSliceItem, error) {
+			return intSliceItem{Key: item.Key, Value: item.Value * 3}, nil
+		}
+
+		reducer := func(_ context.Context, acc int, item intSliceItem) (int, error) {
+			return acc + item.Value, nil
+		}
+
+		for _, size := range []int{1, 7, 64, n * 2} {
+			result, err := stream.MapReduce(
+				context.TODO(),
+				stream.Slice(in),
+				mapper,
+				reducer,
+				0,
+				stream.WithConcurrency(4),
+				stream.WithChunkSize(size),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != sumExp {
+				t.Fatalf("chunk size %d: expected result to be %d, got %d", size, sumExp, result)
+			}
+
+			result, err = stream.MapReduce(
+				context.TODO(),
+				evenOnly,
+				mapper,
+				reducer,
+				0,
+				stream.WithConcurrency(4),
+				stream.WithChunkSize(size),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != evenSumExp {
+				t.Fatalf("chunk size %d: expected wrapped result to be %d, got %d", size, evenSumExp, result)
+			}
+		}
+	})
 	//
+	t.Run("non-positive concurrency is ignored", func(t *testing.T) {
+		type intSliceItem = stream.Item[int, int]
+
+		in := []int{1, 2, 3, 4, 5}
+		mapper := func(_ context.Context, item intSliceItem) (intSliceItem, error) {
+			return item, nil
+		}
+		reducer := func(_ context.Context, acc int, item intSliceItem) (int, error) {
+			return acc + item.Value, nil
+		}
+
+		for _, c := range []int{0, -1} {
+			result, err := stream.MapReduce(context.TODO(), stream.Slice(in), mapper, reducer, 0, stream.WithConcurrency(c))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != 15 {
+				t.Fatalf("concurrency %d: expected result to be 15, got %d", c, result)
+			}
+		}
+	})
+
 	//t.Run("mapper errors below the threshold", func(t *testing.T) {
 	//	const n = 10_000
 	//	in := make([]int, 0, n)
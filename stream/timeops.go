@@ -0,0 +1,184 @@
+package superstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrTimeout = errors.New("timed out waiting for an item")
+)
+
+// stopTimer stops a timer that may not have been started
+func stopTimer(t Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// Throttle emits an item and then drops every item that arrives within d after it
+func Throttle[K, V any](iterable Iterable[K, V], d time.Duration, clock Clock) Iterable[K, V] {
+	clock = clockOrSystem(clock)
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		var window Timer
+		var windowCh <-chan time.Time
+		defer func() { stopTimer(window) }()
+
+		for {
+			select {
+			case item, ok := <-inCh:
+				if !ok {
+					return
+				}
+				if windowCh != nil {
+					continue
+				}
+				if !emit(item) {
+					return
+				}
+				window = clock.NewTimer(d)
+				windowCh = window.C()
+			case <-windowCh:
+				windowCh = nil
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Debounce emits an item only once d has passed without another item arriving,
+// the last item is emitted right away when the source is exhausted
+func Debounce[K, V any](iterable Iterable[K, V], d time.Duration, clock Clock) Iterable[K, V] {
+	clock = clockOrSystem(clock)
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		var pending Item[K, V]
+		var quiet Timer
+		var quietCh <-chan time.Time
+		defer func() { stopTimer(quiet) }()
+
+		for {
+			select {
+			case item, ok := <-inCh:
+				if !ok {
+					if quietCh != nil {
+						emit(pending)
+					}
+					return
+				}
+				stopTimer(quiet)
+				pending = item
+				quiet = clock.NewTimer(d)
+				quietCh = quiet.C()
+			case <-quietCh:
+				quietCh = nil
+				if !emit(pending) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// SampleEvery emits the most recent item every d, provided a new one arrived since the last time
+func SampleEvery[K, V any](iterable Iterable[K, V], d time.Duration, clock Clock) Iterable[K, V] {
+	clock = clockOrSystem(clock)
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		var latest Item[K, V]
+		var fresh bool
+
+		tick := clock.NewTimer(d)
+		defer func() { stopTimer(tick) }()
+
+		for {
+			select {
+			case item, ok := <-inCh:
+				if !ok {
+					return
+				}
+				latest, fresh = item, true
+			case <-tick.C():
+				tick = clock.NewTimer(d)
+				if fresh {
+					fresh = false
+					if !emit(latest) {
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// BufferTime collects the items that arrive within every period of d and emits
+// them together, keyed by the number of the period. Periods without items are
+// skipped and whatever is collected when the source is exhausted is emitted right away.
+func BufferTime[K, V any](iterable Iterable[K, V], d time.Duration, clock Clock) Iterable[int, []Item[K, V]] {
+	clock = clockOrSystem(clock)
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[int, []Item[K, V]]) bool) {
+		var buf []Item[K, V]
+		period := 0
+
+		tick := clock.NewTimer(d)
+		defer func() { stopTimer(tick) }()
+
+		for {
+			select {
+			case item, ok := <-inCh:
+				if !ok {
+					if len(buf) > 0 {
+						emit(Item[int, []Item[K, V]]{Key: period, Value: buf})
+					}
+					return
+				}
+				buf = append(buf, item)
+			case <-tick.C():
+				tick = clock.NewTimer(d)
+				if len(buf) > 0 {
+					if !emit(Item[int, []Item[K, V]]{Key: period, Value: buf}) {
+						return
+					}
+					buf = nil
+				}
+				period++
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Timeout ends the stream when no item arrives within d of the previous one,
+// or of the start. The running MapReduce gets an ErrTimeout for it.
+func Timeout[K, V any](iterable Iterable[K, V], d time.Duration, clock Clock) Iterable[K, V] {
+	clock = clockOrSystem(clock)
+	return operator(iterable, func(ctx context.Context, inCh <-chan Item[K, V], emit func(Item[K, V]) bool) {
+		deadline := clock.NewTimer(d)
+		defer func() { stopTimer(deadline) }()
+
+		for {
+			select {
+			case item, ok := <-inCh:
+				if !ok {
+					return
+				}
+				deadline.Stop()
+				if !emit(item) {
+					return
+				}
+				deadline = clock.NewTimer(d)
+			case <-deadline.C():
+				reportSourceError(ctx, fmt.Errorf("%w after %s", ErrTimeout, d))
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
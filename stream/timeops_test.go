@@ -0,0 +1,213 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timedItem = stream.Item[int, string]
+
+// manualSource hands out ch itself, so a send to ch returns only
+// once the operator reading from it has received the item
+func manualSource(ch chan timedItem) stream.Iterable[int, string] {
+	return func(_ context.Context) <-chan timedItem {
+		return ch
+	}
+}
+
+func receive[K, V any](t *testing.T, ch <-chan stream.Item[K, V]) stream.Item[K, V] {
+	t.Helper()
+	select {
+	case item, ok := <-ch:
+		require.True(t, ok, "expected an item, the stream is over")
+		return item
+	case <-time.After(time.Second):
+		t.Fatal("expected an item")
+	}
+	return stream.Item[K, V]{}
+}
+
+func assertClosed[K, V any](t *testing.T, ch <-chan stream.Item[K, V]) {
+	t.Helper()
+	select {
+	case item, ok := <-ch:
+		require.False(t, ok, "expected the stream to be over, got %v", item)
+	case <-time.After(time.Second):
+		t.Fatal("expected the stream to be over")
+	}
+}
+
+func Test_TimeOperators(t *testing.T) {
+	const d = 10 * time.Millisecond
+
+	start := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("throttle", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+		out := stream.Throttle(manualSource(src), d, clock)(context.Background())
+
+		src <- timedItem{Key: 1}
+		assert.Equal(t, 1, receive(t, out).Key)
+		clock.BlockUntilTimers(1)
+
+		src <- timedItem{Key: 2}
+		clock.Advance(d)
+
+		src <- timedItem{Key: 3}
+		assert.Equal(t, 3, receive(t, out).Key)
+		clock.BlockUntilTimers(2)
+
+		src <- timedItem{Key: 4}
+		close(src)
+		assertClosed(t, out)
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+		out := stream.Debounce(manualSource(src), d, clock)(context.Background())
+
+		src <- timedItem{Key: 1}
+		clock.BlockUntilTimers(1)
+		clock.Advance(d / 2)
+
+		src <- timedItem{Key: 2}
+		clock.BlockUntilTimers(2)
+		clock.Advance(d / 2)
+		clock.Advance(d / 2)
+		assert.Equal(t, 2, receive(t, out).Key)
+
+		src <- timedItem{Key: 3}
+		src <- timedItem{Key: 4}
+		close(src)
+		assert.Equal(t, 4, receive(t, out).Key)
+		assertClosed(t, out)
+	})
+
+	t.Run("sample every interval", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+		out := stream.SampleEvery(manualSource(src), d, clock)(context.Background())
+		clock.BlockUntilTimers(1)
+
+		src <- timedItem{Key: 1}
+		src <- timedItem{Key: 2}
+		clock.Advance(d)
+		assert.Equal(t, 2, receive(t, out).Key)
+
+		clock.BlockUntilTimers(2)
+		clock.Advance(d)
+		clock.BlockUntilTimers(3)
+
+		src <- timedItem{Key: 3}
+		clock.Advance(d)
+		assert.Equal(t, 3, receive(t, out).Key)
+
+		close(src)
+		assertClosed(t, out)
+	})
+
+	t.Run("buffer time", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+		out := stream.BufferTime(manualSource(src), d, clock)(context.Background())
+		clock.BlockUntilTimers(1)
+
+		src <- timedItem{Key: 1}
+		src <- timedItem{Key: 2}
+		clock.Advance(d)
+
+		first := receive(t, out)
+		assert.Equal(t, 0, first.Key)
+		assert.Equal(t, []int{1, 2}, keys(first.Value))
+
+		clock.BlockUntilTimers(2)
+		clock.Advance(d)
+		clock.BlockUntilTimers(3)
+
+		src <- timedItem{Key: 3}
+		close(src)
+
+		last := receive(t, out)
+		assert.Equal(t, 2, last.Key)
+		assert.Equal(t, []int{3}, keys(last.Value))
+		assertClosed(t, out)
+	})
+
+	t.Run("timeout ends the stream with an error", func(t *testing.T) {
+		clock := stream.NewManualClock(start)
+		src := make(chan timedItem)
+
+		type outcome struct {
+			result int
+			err    error
+		}
+		resultCh := make(chan outcome)
+
+		go func() {
+			result, err := stream.MapReduce(
+				context.Background(),
+				stream.Timeout(manualSource(src), d, clock),
+				func(_ context.Context, item timedItem) (timedItem, error) {
+					return item, nil
+				},
+				func(_ context.Context, acc int, item timedItem) (int, error) {
+					return acc + item.Key, nil
+				},
+				0,
+			)
+			resultCh <- outcome{result: result, err: err}
+		}()
+
+		clock.BlockUntilTimers(1)
+		clock.Advance(d - time.Millisecond)
+		src <- timedItem{Key: 1}
+		clock.BlockUntilTimers(2)
+		clock.Advance(d - time.Millisecond)
+		src <- timedItem{Key: 2}
+		clock.BlockUntilTimers(3)
+		clock.Advance(d)
+		close(src)
+
+		o := <-resultCh
+		require.Error(t, o.err)
+		assert.True(t, errors.Is(o.err, stream.ErrTimeout))
+		assert.Contains(t, o.err.Error(), "source error: timed out waiting for an item after 10ms")
+		assert.Equal(t, 3, o.result)
+	})
+
+	t.Run("a nil clock is the system clock", func(t *testing.T) {
+		words := []string{"a", "b", "c"}
+
+		assert.Equal(t, 0, collect(stream.Throttle(stream.Slice(words), time.Minute, nil))[0].Key)
+		assert.Equal(t, []int{2}, keys(collect(stream.Debounce(stream.Slice(words), time.Minute, nil))))
+		assert.Empty(t, collect(stream.SampleEvery(stream.Slice(words), time.Minute, nil)))
+		assert.Len(t, collect(stream.BufferTime(stream.Slice(words), time.Minute, nil)), 1)
+		assert.Len(t, collect(stream.Timeout(stream.Slice(words), time.Minute, nil)), 3)
+	})
+
+	t.Run("time operators stop with their context", func(t *testing.T) {
+		assertNoLeaks(t, func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			src := make(chan timedItem)
+			clock := stream.NewManualClock(start)
+
+			out := stream.Debounce(
+				stream.SampleEvery(manualSource(src), d, clock),
+				d,
+				clock,
+			)(ctx)
+
+			cancel()
+			close(src)
+			assertClosed(t, out)
+		})
+	})
+}
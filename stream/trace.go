@@ -0,0 +1,133 @@
+package superstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// reducerThread is the trace thread of the reducer, workers come after it
+const reducerThread = 0
+
+type (
+	// Tracer records a span for every map and reduce call of the runs it is
+	// given to with WithTracer and writes them as Chrome trace-event JSON,
+	// which chrome://tracing or Perfetto show as a timeline per worker.
+	// Map spans time the mapper alone, every retry and hedged call gets a
+	// span of its own and waiting for a weight budget or a circuit breaker
+	// shows as time the worker is idle.
+	Tracer struct {
+		mux     sync.Mutex
+		started time.Time
+		events  []traceEvent
+		threads map[int]bool
+	}
+
+	// traceEvent is a complete or a metadata event of the trace-event format
+	traceEvent struct {
+		Name string            `json:"name"`
+		Cat  string            `json:"cat,omitempty"`
+		Ph   string            `json:"ph"`
+		Ts   int64             `json:"ts"`
+		Dur  int64             `json:"dur"`
+		Pid  int               `json:"pid"`
+		Tid  int               `json:"tid"`
+		Args map[string]string `json:"args,omitempty"`
+	}
+
+	// traceWorkerKey holds the worker a call of the mapper is made by
+	traceWorkerKey struct{}
+
+	traceFile struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}
+)
+
+func NewTracer() *Tracer {
+	return &Tracer{started: time.Now(), threads: make(map[int]bool)}
+}
+
+// WithTracer records the map and reduce calls of the run with t
+func WithTracer(t *Tracer) reducerOption {
+	return func(fc *flowControl) {
+		fc.tracer = t
+	}
+}
+
+// WriteTo writes the spans recorded so far as a Chrome trace-event JSON object
+func (t *Tracer) WriteTo(w io.Writer) (int64, error) {
+	t.mux.Lock()
+	b, err := json.Marshal(traceFile{TraceEvents: t.events, DisplayTimeUnit: "ms"})
+	t.mux.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// tracedMapper records a map span for every call of the mapper, it goes
+// under the other wrappers so that only the mapper itself is timed
+func tracedMapper[K comparable, I, O any](fc *flowControl, m mapper[K, I, O]) mapper[K, I, O] {
+	if fc.tracer == nil {
+		return m
+	}
+
+	return func(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+		started := time.Now()
+		result, err := safeMap(ctx, m, item)
+		worker, _ := ctx.Value(traceWorkerKey{}).(int)
+		fc.tracer.mapSpan(worker, item.Key, started, err)
+		return result, err
+	}
+}
+
+func (t *Tracer) mapSpan(worker int, key any, started time.Time, err error) {
+	t.span("map", worker+1, key, started, err)
+}
+
+func (t *Tracer) reduceSpan(key any, started time.Time, err error) {
+	t.span("reduce", reducerThread, key, started, err)
+}
+
+func (t *Tracer) span(name string, tid int, key any, started time.Time, err error) {
+	dur := time.Since(started)
+	args := map[string]string{"key": fmt.Sprint(key)}
+	if err != nil {
+		args["error"] = err.Error()
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if !t.threads[tid] {
+		t.threads[tid] = true
+		threadName := "reducer"
+		if tid != reducerThread {
+			threadName = fmt.Sprintf("worker %d", tid-1)
+		}
+		t.events = append(t.events, traceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  1,
+			Tid:  tid,
+			Args: map[string]string{"name": threadName},
+		})
+	}
+
+	t.events = append(t.events, traceEvent{
+		Name: name,
+		Cat:  name,
+		Ph:   "X",
+		Ts:   started.Sub(t.started).Microseconds(),
+		Dur:  dur.Microseconds(),
+		Pid:  1,
+		Tid:  tid,
+		Args: args,
+	})
+}
@@ -0,0 +1,131 @@
+package superstream_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type traceEvent struct {
+	Name string            `json:"name"`
+	Ph   string            `json:"ph"`
+	Ts   int64             `json:"ts"`
+	Dur  *int64            `json:"dur"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args"`
+}
+
+func readTrace(t *testing.T, tracer *stream.Tracer) []traceEvent {
+	var buf bytes.Buffer
+	_, err := tracer.WriteTo(&buf)
+	require.NoError(t, err)
+
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	return trace.TraceEvents
+}
+
+func Test_Tracer(t *testing.T) {
+	const n = 30
+	in := make([]int, n)
+
+	tracer := stream.NewTracer()
+	_, err := stream.MapReduce(
+		context.TODO(),
+		stream.Slice(in),
+		func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			time.Sleep(100 * time.Microsecond)
+			if item.Key == 7 {
+				return item, errors.New("unlucky")
+			}
+			return item, nil
+		},
+		func(_ context.Context, acc int, _ stream.Item[int, int]) (int, error) { return acc + 1, nil },
+		0,
+		stream.WithConcurrency(3),
+		stream.WithChunkSize(4),
+		stream.ErrorThreshold(2),
+		stream.WithTracer(tracer),
+	)
+	require.NoError(t, err)
+
+	spans := make(map[string]int)
+	threads := make(map[int]string)
+	mapKeys := make(map[string]bool)
+	for _, e := range readTrace(t, tracer) {
+		switch e.Ph {
+		case "M":
+			threads[e.Tid] = e.Args["name"]
+		case "X":
+			require.NotNil(t, e.Dur, "complete events need a duration, even a zero one")
+			spans[e.Name]++
+			assert.GreaterOrEqual(t, e.Ts, int64(0))
+			if e.Name == "map" {
+				assert.Contains(t, []int{1, 2, 3}, e.Tid)
+				assert.GreaterOrEqual(t, *e.Dur, int64(100))
+				mapKeys[e.Args["key"]] = true
+				if e.Args["key"] == "7" {
+					assert.Equal(t, "unlucky", e.Args["error"])
+				}
+			} else {
+				assert.Equal(t, 0, e.Tid)
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]int{"map": n, "reduce": n - 1}, spans)
+	assert.Len(t, mapKeys, n)
+	assert.Equal(t, "reducer", threads[0])
+	for tid := range threads {
+		if tid != 0 {
+			assert.Regexp(t, `^worker \d$`, threads[tid])
+		}
+	}
+}
+
+func Test_TracerTimesTheMapperAlone(t *testing.T) {
+	const backoff = 50 * time.Millisecond
+
+	var calls int32
+	tracer := stream.NewTracer()
+	_, err := stream.MapReduce(
+		context.TODO(),
+		stream.Slice([]int{1}),
+		func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return item, errors.New("flaky")
+			}
+			return item, nil
+		},
+		func(_ context.Context, acc int, _ stream.Item[int, int]) (int, error) { return acc + 1, nil },
+		0,
+		stream.WithRetries(1, backoff),
+		stream.WithTracer(tracer),
+	)
+	require.NoError(t, err)
+
+	var maps []traceEvent
+	for _, e := range readTrace(t, tracer) {
+		if e.Ph == "X" && e.Name == "map" {
+			maps = append(maps, e)
+		}
+	}
+
+	// the retry backoff is between the spans, not in them
+	require.Len(t, maps, 2)
+	assert.Equal(t, "flaky", maps[0].Args["error"])
+	for _, e := range maps {
+		assert.Less(t, *e.Dur, backoff.Microseconds())
+	}
+	assert.GreaterOrEqual(t, maps[1].Ts-maps[0].Ts, backoff.Microseconds())
+}
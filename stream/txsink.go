@@ -0,0 +1,253 @@
+package superstream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type (
+	// TxSink is a sink whose writes only become visible once committed.
+	// Every transaction starts with Begin and ends with either Commit, after
+	// a successful PreCommit, or Abort, which discards what was written in it.
+	TxSink[K, V any] interface {
+		Begin(ctx context.Context) error
+		Write(ctx context.Context, item Item[K, V]) error
+		// PreCommit makes the writes durable without making them visible yet
+		PreCommit(ctx context.Context) error
+		Commit(ctx context.Context) error
+		Abort(ctx context.Context) error
+	}
+
+	// replacingSink is a TxSink whose every commit may replace the output of
+	// the one before, which batches committed as the run goes must not do
+	replacingSink interface {
+		replacesOnCommit() bool
+	}
+
+	fileTxSink[K, V any] struct {
+		name   func(txn int) string
+		single bool
+		codec  Codec[Item[K, V]]
+		txn    int
+		target string
+		tmp    *os.File
+		buf    *bufio.Writer
+		enc    Encoder[Item[K, V]]
+	}
+)
+
+// WithCommitEvery makes RunIntoTx commit after every n items written,
+// instead of only once the run is over
+func WithCommitEvery(n int) reducerOption {
+	return func(fc *flowControl) {
+		if n > 0 {
+			fc.commitEvery = n
+		}
+	}
+}
+
+// RunIntoTx is RunInto for transactional sinks: the results are written in a
+// transaction that is committed once MapReduce succeeds and aborted when it
+// fails or ctx is done, so the output of a failed run never becomes visible.
+// With WithCommitEvery the results are committed in batches as the run goes,
+// only the batch being written when the run fails is aborted then. Batches
+// need a sink that keeps every commit, such as FilePartsTxSink, with one whose
+// commits replace each other, such as FileTxSink, ErrInvalidOption is returned.
+func RunIntoTx[K comparable, I, O any](
+	ctx context.Context,
+	iterable Iterable[K, I],
+	mapper mapper[K, I, O],
+	sink TxSink[K, O],
+	options ...reducerOption,
+) error {
+	fc := &flowControl{}
+	for _, opt := range options {
+		opt(fc)
+	}
+
+	if rs, ok := sink.(replacingSink); ok && fc.commitEvery > 0 && rs.replacesOnCommit() {
+		return fmt.Errorf("%w: WithCommitEvery with a sink whose every commit replaces the last one", ErrInvalidOption)
+	}
+
+	if err := sink.Begin(ctx); err != nil {
+		return fmt.Errorf("sink begin error: %w", err)
+	}
+
+	// after a commit the next transaction only begins with the next item,
+	// so that a run ending right after one commits no empty batch.
+	// A failed commit or begin leaves no transaction to write to, so it ends the run.
+	var txErr error
+	open := true
+	written := 0
+	write := func(ctx context.Context, acc struct{}, item Item[K, O]) (struct{}, error) {
+		if txErr != nil {
+			return acc, txErr
+		}
+
+		if !open {
+			if err := sink.Begin(ctx); err != nil {
+				txErr = fmt.Errorf("sink begin error: %w", err)
+				return acc, txErr
+			}
+			open = true
+		}
+
+		if err := sink.Write(ctx, item); err != nil {
+			return acc, err
+		}
+
+		written++
+		if fc.commitEvery > 0 && written%fc.commitEvery == 0 {
+			open = false
+			txErr = commitTx(ctx, sink)
+		}
+
+		return acc, txErr
+	}
+
+	_, err := MapReduce(ctx, iterable, mapper, write, struct{}{}, options...)
+	if err == nil {
+		err = txErr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	// a failed commit or begin has no transaction left open either
+	if !open {
+		return err
+	}
+
+	if err == nil {
+		return commitTx(ctx, sink)
+	}
+
+	if abortErr := sink.Abort(context.Background()); abortErr != nil {
+		err = appendError(err, fmt.Errorf("sink abort error: %w", abortErr))
+	}
+
+	return err
+}
+
+// commitTx commits the transaction of the sink, aborting it if it cannot be
+func commitTx[K, V any](ctx context.Context, sink TxSink[K, V]) error {
+	if err := sink.PreCommit(ctx); err != nil {
+		err = fmt.Errorf("sink pre-commit error: %w", err)
+		if abortErr := sink.Abort(context.Background()); abortErr != nil {
+			err = appendError(err, fmt.Errorf("sink abort error: %w", abortErr))
+		}
+		return err
+	}
+
+	if err := sink.Commit(ctx); err != nil {
+		return fmt.Errorf("sink commit error: %w", err)
+	}
+
+	return nil
+}
+
+// FileTxSink encodes every transaction into a temporary file next to path,
+// which is renamed to path once committed, so readers of path only ever see
+// complete output. Every commit replaces the file, so it cannot take the
+// batches of WithCommitEvery, FilePartsTxSink can.
+func FileTxSink[K, V any](path string, codec Codec[Item[K, V]]) TxSink[K, V] {
+	return &fileTxSink[K, V]{name: func(int) string { return path }, single: true, codec: codec}
+}
+
+// FilePartsTxSink is FileTxSink with a file of its own for every committed
+// transaction, named by name from the number of the transaction, from 0 on.
+// Aborted transactions take no number.
+func FilePartsTxSink[K, V any](name func(txn int) string, codec Codec[Item[K, V]]) TxSink[K, V] {
+	return &fileTxSink[K, V]{name: name, codec: codec}
+}
+
+func (s *fileTxSink[K, V]) replacesOnCommit() bool {
+	return s.single
+}
+
+func (s *fileTxSink[K, V]) Begin(_ context.Context) error {
+	if s.tmp != nil {
+		return errors.New("transaction already in progress")
+	}
+
+	target := s.name(s.txn)
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	s.target = target
+	s.tmp = tmp
+	s.buf = bufio.NewWriter(tmp)
+	s.enc = s.codec.NewEncoder(s.buf)
+	return nil
+}
+
+func (s *fileTxSink[K, V]) Write(_ context.Context, item Item[K, V]) error {
+	if s.tmp == nil {
+		return errors.New("no transaction in progress")
+	}
+
+	return s.enc.Encode(item)
+}
+
+func (s *fileTxSink[K, V]) PreCommit(_ context.Context) error {
+	if s.tmp == nil {
+		return errors.New("no transaction in progress")
+	}
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+
+	return s.tmp.Sync()
+}
+
+func (s *fileTxSink[K, V]) Commit(_ context.Context) error {
+	if s.tmp == nil {
+		return errors.New("no transaction in progress")
+	}
+
+	tmp := s.tmp
+	s.tmp, s.buf, s.enc = nil, nil, nil
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	path := s.target
+	s.txn++
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func (s *fileTxSink[K, V]) Abort(_ context.Context) error {
+	if s.tmp == nil {
+		return nil
+	}
+
+	tmp := s.tmp
+	s.tmp, s.buf, s.enc = nil, nil, nil
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
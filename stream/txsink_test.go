@@ -0,0 +1,178 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// txLog is a TxSink that records the calls it gets
+type txLog struct {
+	calls        []string
+	preCommitErr error
+}
+
+func (l *txLog) Begin(context.Context) error {
+	l.calls = append(l.calls, "begin")
+	return nil
+}
+
+func (l *txLog) Write(_ context.Context, item stream.Item[int, int]) error {
+	l.calls = append(l.calls, fmt.Sprintf("write %d", item.Value))
+	return nil
+}
+
+func (l *txLog) PreCommit(context.Context) error {
+	l.calls = append(l.calls, "pre-commit")
+	return l.preCommitErr
+}
+
+func (l *txLog) Commit(context.Context) error {
+	l.calls = append(l.calls, "commit")
+	return nil
+}
+
+func (l *txLog) Abort(context.Context) error {
+	l.calls = append(l.calls, "abort")
+	return nil
+}
+
+func Test_RunIntoTx(t *testing.T) {
+	identity := func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+		return item, nil
+	}
+	failOn := func(bad int) func(context.Context, stream.Item[int, int]) (stream.Item[int, int], error) {
+		return func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+			if item.Value == bad {
+				return item, errors.New("bad item")
+			}
+			return item, nil
+		}
+	}
+	files := func(t *testing.T, dir string) []string {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+	codec := stream.JSONCodec[stream.Item[int, int]]()
+
+	t.Run("protocol", func(t *testing.T) {
+		var ok txLog
+		require.NoError(t, stream.RunIntoTx(context.TODO(), stream.Slice([]int{1, 2}), identity, stream.TxSink[int, int](&ok)))
+		assert.Equal(t, []string{"begin", "write 1", "write 2", "pre-commit", "commit"}, ok.calls)
+
+		var failed txLog
+		err := stream.RunIntoTx(context.TODO(), stream.Slice([]int{1, 2}), failOn(2), stream.TxSink[int, int](&failed))
+		require.Error(t, err)
+		assert.Equal(t, []string{"begin", "write 1", "abort"}, failed.calls)
+
+		rejected := txLog{preCommitErr: errors.New("disk full")}
+		err = stream.RunIntoTx(context.TODO(), stream.Slice([]int{1}), identity, stream.TxSink[int, int](&rejected))
+		assert.ErrorContains(t, err, "disk full")
+		assert.Equal(t, []string{"begin", "write 1", "pre-commit", "abort"}, rejected.calls)
+
+		var batched txLog
+		err = stream.RunIntoTx(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3, 4}),
+			identity,
+			stream.TxSink[int, int](&batched),
+			stream.WithCommitEvery(2),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"begin", "write 1", "write 2", "pre-commit", "commit",
+			"begin", "write 3", "write 4", "pre-commit", "commit",
+		}, batched.calls, "no empty batch is committed after the last one")
+	})
+
+	t.Run("file is only visible after a successful run", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.ndjson")
+
+		err := stream.RunIntoTx(context.TODO(), stream.Slice([]int{1, 2, 3}), failOn(3), stream.FileTxSink(path, codec))
+		require.Error(t, err)
+		assert.Empty(t, files(t, dir), "a failed run leaves nothing behind")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = stream.RunIntoTx(ctx, stream.Slice([]int{1, 2, 3}), identity, stream.FileTxSink(path, codec))
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Empty(t, files(t, dir), "a cancelled run leaves nothing behind")
+
+		require.NoError(t, stream.RunIntoTx(context.TODO(), stream.Slice([]int{1, 2, 3}), identity, stream.FileTxSink(path, codec)))
+		assert.Equal(t, []string{"out.ndjson"}, files(t, dir))
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 3, strings.Count(string(b), "\n"))
+	})
+
+	t.Run("commit every n items", func(t *testing.T) {
+		parts := func(dir string) func(int) string {
+			return func(txn int) string {
+				return filepath.Join(dir, fmt.Sprintf("part-%d.ndjson", txn))
+			}
+		}
+
+		dir := t.TempDir()
+		err := stream.RunIntoTx(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3, 4, 5}),
+			identity,
+			stream.FilePartsTxSink(parts(dir), codec),
+			stream.WithCommitEvery(2),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"part-0.ndjson", "part-1.ndjson", "part-2.ndjson"}, files(t, dir))
+
+		dir = t.TempDir()
+		err = stream.RunIntoTx(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3, 4}),
+			identity,
+			stream.FilePartsTxSink(parts(dir), codec),
+			stream.WithCommitEvery(2),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"part-0.ndjson", "part-1.ndjson"}, files(t, dir), "no empty part after the last batch")
+
+		dir = t.TempDir()
+		err = stream.RunIntoTx(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3, 4, 5}),
+			failOn(4),
+			stream.FilePartsTxSink(parts(dir), codec),
+			stream.WithCommitEvery(2),
+		)
+		require.Error(t, err)
+		assert.Equal(t, []string{"part-0.ndjson"}, files(t, dir), "only the batch being written is aborted")
+	})
+
+	t.Run("commit every n items into one file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "100%.ndjson")
+
+		err := stream.RunIntoTx(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 3, 4, 5, 6, 7}),
+			identity,
+			stream.FileTxSink(path, codec),
+			stream.WithCommitEvery(3),
+		)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption), "every batch would replace the one before")
+		assert.Empty(t, files(t, dir))
+	})
+}
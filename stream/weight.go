@@ -0,0 +1,146 @@
+package superstream
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrOverweight = errors.New("item is heavier than the weight budget")
+
+type (
+	itemWeight struct {
+		// fn is a func(Item[K, I]) int64
+		fn     any
+		budget int64
+	}
+
+	// weightedSemaphore hands out a fixed budget of weight, callers
+	// are served in the order they asked, so a heavy item waiting for
+	// the budget to free up is not overtaken by a stream of light ones
+	weightedSemaphore struct {
+		mux     sync.Mutex
+		size    int64
+		cur     int64
+		waiters list.List
+	}
+
+	weightWaiter struct {
+		n     int64
+		ready chan struct{}
+	}
+)
+
+// WithWeight caps the total weight of the items being mapped at the same
+// time by budget, instead of only their number. The weight of an item is
+// whatever weight says it is, bytes or CPU units for instance, and has to
+// accept the item type of the source. Items heavier than the whole budget
+// fail with ErrOverweight. WithConcurrency still bounds the number of items
+// in flight, so it has to be high enough for the budget to be used up.
+func WithWeight[K comparable, I any](weight func(Item[K, I]) int64, budget int64) reducerOption {
+	return func(fc *flowControl) {
+		fc.weight = &itemWeight{fn: weight, budget: budget}
+	}
+}
+
+func weightedMapper[K comparable, I, O any](fc *flowControl, m mapper[K, I, O]) (mapper[K, I, O], error) {
+	if fc.weight == nil {
+		return m, nil
+	}
+
+	weight, ok := fc.weight.fn.(func(Item[K, I]) int64)
+	if !ok || weight == nil {
+		return nil, fmt.Errorf("%w: WithWeight expects a %T, got a %T", ErrInvalidOption, weight, fc.weight.fn)
+	}
+
+	if fc.weight.budget <= 0 {
+		return nil, fmt.Errorf("%w: WithWeight budget must be positive, got %d", ErrInvalidOption, fc.weight.budget)
+	}
+
+	sem := newWeightedSemaphore(fc.weight.budget)
+	return func(ctx context.Context, item Item[K, I]) (Item[K, O], error) {
+		n := weight(item)
+		if n < 0 {
+			n = 0
+		}
+
+		if n > sem.size {
+			return Zero[Item[K, O]](), fmt.Errorf("%w: weight %d, budget %d", ErrOverweight, n, sem.size)
+		}
+
+		if err := sem.acquire(ctx, n); err != nil {
+			return Zero[Item[K, O]](), err
+		}
+		defer sem.release(n)
+
+		return safeMap(ctx, m, item)
+	}, nil
+}
+
+func newWeightedSemaphore(size int64) *weightedSemaphore {
+	return &weightedSemaphore{size: size}
+}
+
+// acquire blocks until n can be taken from the budget or ctx is done
+func (s *weightedSemaphore) acquire(ctx context.Context, n int64) error {
+	s.mux.Lock()
+	if s.waiters.Len() == 0 && s.size-s.cur >= n {
+		s.cur += n
+		s.mux.Unlock()
+		return nil
+	}
+
+	w := &weightWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mux.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		select {
+		case <-w.ready:
+			// granted while giving up, hand it back
+			s.cur -= n
+			s.notify()
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			// the front waiter leaving may let the ones behind it in
+			if isFront {
+				s.notify()
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *weightedSemaphore) release(n int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.cur -= n
+	s.notify()
+}
+
+// notify lets waiters in, in order, for as long as the budget allows
+func (s *weightedSemaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+
+		w := front.Value.(*weightWaiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
@@ -0,0 +1,125 @@
+package superstream_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	stream "github.com/denismitr/dataflow/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inFlight tracks the weight being mapped and the most it ever got to
+type inFlight struct {
+	mux      sync.Mutex
+	cur, max int64
+}
+
+func (f *inFlight) mapper(weight func(stream.Item[int, int]) int64) func(context.Context, stream.Item[int, int]) (stream.Item[int, int], error) {
+	return func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+		n := weight(item)
+		f.mux.Lock()
+		f.cur += n
+		if f.cur > f.max {
+			f.max = f.cur
+		}
+		f.mux.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		f.mux.Lock()
+		f.cur -= n
+		f.mux.Unlock()
+		return item, nil
+	}
+}
+
+func Test_Weight(t *testing.T) {
+	bySize := func(item stream.Item[int, int]) int64 { return int64(item.Value) }
+	count := func(_ context.Context, acc int, _ stream.Item[int, int]) (int, error) { return acc + 1, nil }
+
+	t.Run("in-flight weight stays within the budget", func(t *testing.T) {
+		in := make([]int, 200)
+		for i := range in {
+			in[i] = i%5 + 1
+		}
+
+		var f inFlight
+		result, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice(in),
+			f.mapper(bySize),
+			count,
+			0,
+			stream.WithConcurrency(16),
+			stream.WithChunkSize(1),
+			stream.WithWeight(bySize, 10),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 200, result)
+		assert.LessOrEqual(t, f.max, int64(10))
+		assert.Greater(t, f.max, int64(5), "the budget should be shared by several items")
+	})
+
+	t.Run("items heavier than the budget fail", func(t *testing.T) {
+		var f inFlight
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1, 2, 50, 3}),
+			f.mapper(bySize),
+			count,
+			0,
+			stream.WithConcurrency(4),
+			stream.WithWeight(bySize, 10),
+		)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, stream.ErrOverweight))
+	})
+
+	t.Run("waiting for the budget stops with the context", func(t *testing.T) {
+		assertNoLeaks(t, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			_, err := stream.MapReduce(
+				ctx,
+				stream.Slice([]int{8, 8, 8, 8}),
+				func(ctx context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) {
+					<-ctx.Done()
+					return item, ctx.Err()
+				},
+				count,
+				0,
+				stream.WithConcurrency(4),
+				stream.WithChunkSize(1),
+				stream.WithWeight(bySize, 10),
+			)
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		})
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1}),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) { return item, nil },
+			count,
+			0,
+			stream.WithWeight(func(stream.Item[string, int]) int64 { return 1 }, 10),
+		)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+
+		_, err = stream.MapReduce(
+			context.TODO(),
+			stream.Slice([]int{1}),
+			func(_ context.Context, item stream.Item[int, int]) (stream.Item[int, int], error) { return item, nil },
+			count,
+			0,
+			stream.WithWeight(bySize, 0),
+		)
+		assert.True(t, errors.Is(err, stream.ErrInvalidOption))
+	})
+}